@@ -0,0 +1,291 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Codec encodes and decodes streams of pairs.
+type Codec interface {
+	// Name is the name the codec is selected by in Resource and ResourceHint.
+	Name() string
+	// Extension is the file extension of resources encoded with the codec.
+	Extension() string
+	NewReader(r io.Reader) PairReader
+	NewWriter(w io.Writer) PairWriter
+}
+
+// SplittableCodec is implemented by codecs that encode every pair on a line
+// of its own, so that inputs encoded with them can be split at any line
+// boundary; see WithSplitSize.
+type SplittableCodec interface {
+	Codec
+	Splittable() bool
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+func init() {
+	RegisterCodec(TSVCodec{})
+	RegisterCodec(JSONLinesCodec{})
+	RegisterCodec(BinaryCodec{})
+	RegisterCodec(CSVCodec{})
+}
+
+// RegisterCodec makes `codec` available by its name. It must be registered
+// on both the driver and the workers.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// LookupCodec returns the codec registered as `name`; the empty name stands
+// for TSV.
+func LookupCodec(name string) (Codec, error) {
+	if name == "" {
+		name = TSVCodec{}.Name()
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec: %s", name)
+	}
+	return codec, nil
+}
+
+// TSVCodec is the default codec; see MarshalPairs.
+type TSVCodec struct{}
+
+func (TSVCodec) Name() string      { return "tsv" }
+func (TSVCodec) Extension() string { return ".tsv" }
+func (TSVCodec) Splittable() bool  { return true }
+
+func (TSVCodec) NewReader(r io.Reader) PairReader {
+	return NewTSVReader(r)
+}
+
+func (TSVCodec) NewWriter(w io.Writer) PairWriter {
+	return NewTSVWriter(w)
+}
+
+// JSONLinesCodec encodes every pair as a JSON object on a line of its own,
+// e.g. `{"K":"key","V":"value"}`.
+type JSONLinesCodec struct{}
+
+func (JSONLinesCodec) Name() string      { return "jsonl" }
+func (JSONLinesCodec) Extension() string { return ".jsonl" }
+func (JSONLinesCodec) Splittable() bool  { return true }
+
+func (JSONLinesCodec) NewReader(r io.Reader) PairReader {
+	return &jsonLinesReader{d: json.NewDecoder(r)}
+}
+
+func (JSONLinesCodec) NewWriter(w io.Writer) PairWriter {
+	bw := bufio.NewWriter(w)
+	return &jsonLinesWriter{w: bw, e: json.NewEncoder(bw)}
+}
+
+type jsonLinesReader struct {
+	d *json.Decoder
+}
+
+func (j *jsonLinesReader) Read() (pair Pair, err error) {
+	err = j.d.Decode(&pair)
+	return
+}
+
+type jsonLinesWriter struct {
+	w *bufio.Writer
+	e *json.Encoder
+}
+
+func (j *jsonLinesWriter) Write(pair Pair) error {
+	// Encode terminates every object with a newline.
+	return j.e.Encode(pair)
+}
+
+func (j *jsonLinesWriter) Flush() error {
+	return j.w.Flush()
+}
+
+// BinaryCodec is a compact format for intermediate data, in which every key
+// and value is prefixed with its length as a uvarint. Keys and values may
+// contain arbitrary bytes.
+type BinaryCodec struct{}
+
+func (BinaryCodec) Name() string      { return "binary" }
+func (BinaryCodec) Extension() string { return ".bin" }
+
+func (BinaryCodec) NewReader(r io.Reader) PairReader {
+	return &binaryReader{r: bufio.NewReader(r)}
+}
+
+func (BinaryCodec) NewWriter(w io.Writer) PairWriter {
+	return &binaryWriter{w: bufio.NewWriter(w)}
+}
+
+type binaryReader struct {
+	r *bufio.Reader
+}
+
+func (b *binaryReader) Read() (Pair, error) {
+	key, err := b.readString()
+	if err != nil {
+		return Pair{}, err
+	}
+	value, err := b.readString()
+	if err == io.EOF {
+		return Pair{}, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return Pair{}, err
+	}
+	return Pair{Key: key, Value: value}, nil
+}
+
+const (
+	// maxBinaryLength bounds the length of keys and values, so that corrupt
+	// or wrongly-coded data is an error rather than a huge allocation.
+	maxBinaryLength = 1 << 30
+	// binaryChunkLength is the length above which strings are read in
+	// chunks, so that memory grows only with the data actually present.
+	binaryChunkLength = 1 << 16
+)
+
+// readString returns io.EOF only if there is no data left at all.
+func (b *binaryReader) readString() (string, error) {
+	n, err := binary.ReadUvarint(b.r)
+	if err != nil {
+		return "", err
+	}
+	if n > maxBinaryLength {
+		return "", errors.Errorf("binary length %d exceeds %d; the data is corrupt or not binary-coded", n, maxBinaryLength)
+	}
+	if n <= binaryChunkLength {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(b.r, buf); err != nil {
+			if err == io.EOF {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		return string(buf), nil
+	}
+
+	var sb strings.Builder
+	if _, err := io.CopyN(&sb, b.r, int64(n)); err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+type binaryWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (b *binaryWriter) Write(pair Pair) error {
+	if err := b.writeString(pair.Key); err != nil {
+		return err
+	}
+	return b.writeString(pair.Value)
+}
+
+func (b *binaryWriter) writeString(s string) error {
+	n := binary.PutUvarint(b.buf[:], uint64(len(s)))
+	if _, err := b.w.Write(b.buf[:n]); err != nil {
+		return err
+	}
+	_, err := b.w.WriteString(s)
+	return err
+}
+
+func (b *binaryWriter) Flush() error {
+	return b.w.Flush()
+}
+
+// CSVCodec encodes every pair as an RFC 4180 record of two fields. Like
+// with TSV, records of a single field are read as values with empty keys.
+type CSVCodec struct{}
+
+func (CSVCodec) Name() string      { return "csv" }
+func (CSVCodec) Extension() string { return ".csv" }
+
+func (CSVCodec) NewReader(r io.Reader) PairReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvReader{r: reader}
+}
+
+func (CSVCodec) NewWriter(w io.Writer) PairWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	nRecord int
+}
+
+func (c *csvReader) Read() (Pair, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		return Pair{}, err
+	}
+	c.nRecord++
+	switch len(record) {
+	case 1:
+		return Pair{Key: "", Value: record[0]}, nil
+	case 2:
+		return Pair{Key: record[0], Value: record[1]}, nil
+	}
+	return Pair{}, errors.Errorf("record %d: expected 2 fields, got %d", c.nRecord, len(record))
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(pair Pair) error {
+	return c.w.Write([]string{pair.Key, pair.Value})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
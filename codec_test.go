@@ -0,0 +1,181 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encodePairs writes `pairs` with `codec`.
+func encodePairs(t *testing.T, codec Codec, pairs []Pair) string {
+	var b strings.Builder
+	w := codec.NewWriter(&b)
+	for _, pair := range pairs {
+		if err := w.Write(pair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// decodePairs reads all pairs of `data` with `codec`, up to the first error
+// other than io.EOF.
+func decodePairs(codec Codec, data string) ([]Pair, error) {
+	r := codec.NewReader(strings.NewReader(data))
+	var pairs []Pair
+	for {
+		pair, err := r.Read()
+		if err == io.EOF {
+			return pairs, nil
+		} else if err != nil {
+			return pairs, err
+		}
+		pairs = append(pairs, pair)
+	}
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	textPairs := []Pair{
+		{Key: "plain", Value: "value"},
+		{Key: "", Value: "empty key"},
+		{Key: "empty value", Value: ""},
+		{Key: "", Value: ""},
+		{Key: "tab\tkey", Value: "multi\nline\nvalue\n"},
+		{Key: `"quoted"`, Value: `a, "b", c`},
+		{Key: `back\slash`, Value: `{"K":"not a pair"}`},
+		{Key: "unicode ключ", Value: "значение ✓"},
+	}
+	var allBytes []byte
+	for i := 0; i < 256; i++ {
+		allBytes = append(allBytes, byte(i))
+	}
+	binaryPairs := append(textPairs,
+		Pair{Key: "cr\r", Value: "\r\n"},
+		Pair{Key: string(allBytes), Value: "\xff\xfe\x00"},
+		Pair{Key: "\x8b\x1f", Value: strings.Repeat("\x00\x80", binaryChunkLength)},
+	)
+
+	tests := []struct {
+		codec Codec
+		pairs []Pair
+	}{
+		{JSONLinesCodec{}, textPairs},
+		{BinaryCodec{}, binaryPairs},
+		{CSVCodec{}, textPairs},
+	}
+	for _, test := range tests {
+		data := encodePairs(t, test.codec, test.pairs)
+		got, err := decodePairs(test.codec, data)
+		if err != nil {
+			t.Errorf("%s: %v", test.codec.Name(), err)
+		} else if !reflect.DeepEqual(got, test.pairs) {
+			t.Errorf("%s: read %q, want %q", test.codec.Name(), got, test.pairs)
+		}
+
+		if got, err := decodePairs(test.codec, encodePairs(t, test.codec, nil)); err != nil || len(got) != 0 {
+			t.Errorf("%s: read %q, %v from no pairs", test.codec.Name(), got, err)
+		}
+	}
+}
+
+func TestCodecsTruncated(t *testing.T) {
+	pairs := []Pair{{Key: "key", Value: "value"}, {Key: "long", Value: strings.Repeat("v", 2*binaryChunkLength)}}
+	for _, codec := range []Codec{JSONLinesCodec{}, BinaryCodec{}} {
+		data := encodePairs(t, codec, pairs)
+		firstLength := len(encodePairs(t, codec, pairs[:1]))
+		// Cuts within either pair, short of a trailing newline.
+		for _, cut := range []int{1, 2, 5, firstLength - 2, firstLength + 1, firstLength + 3, firstLength + 7, len(data) - 2} {
+			got, err := decodePairs(codec, data[:cut])
+			if err != io.ErrUnexpectedEOF {
+				t.Errorf("%s: reading %d of %d bytes returned %v, want %v", codec.Name(), cut, len(data), err, io.ErrUnexpectedEOF)
+			}
+			wantPairs := 0
+			if cut > firstLength {
+				wantPairs = 1
+			}
+			if len(got) != wantPairs {
+				t.Errorf("%s: read %d pairs before the truncation at %d, want %d", codec.Name(), len(got), cut, wantPairs)
+			}
+		}
+	}
+
+	if _, err := decodePairs(CSVCodec{}, "key,\"unterminated\n"); err == nil {
+		t.Error("csv: reading an unterminated quoted field did not fail")
+	}
+}
+
+func TestBinaryCodecLengths(t *testing.T) {
+	uvarint := func(n uint64) string {
+		var buf [binary.MaxVarintLen64]byte
+		return string(buf[:binary.PutUvarint(buf[:], n)])
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"key beyond the bound", uvarint(maxBinaryLength + 1), nil},
+		{"value beyond the bound", uvarint(1) + "k" + uvarint(maxBinaryLength+1), nil},
+		{"largest uvarint", uvarint(1<<64 - 1), nil},
+		{"overflowing uvarint", strings.Repeat("\xff", binary.MaxVarintLen64+1), nil},
+		{"key at the bound without data", uvarint(maxBinaryLength) + "short", io.ErrUnexpectedEOF},
+		{"value at the bound without data", uvarint(1) + "k" + uvarint(maxBinaryLength), io.ErrUnexpectedEOF},
+		{"truncated uvarint", "\x80", io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		got, err := decodePairs(BinaryCodec{}, test.data)
+		if err == nil {
+			t.Errorf("%s: read %q, want an error", test.name, got)
+		} else if test.wantErr != nil && err != test.wantErr {
+			t.Errorf("%s: returned %v, want %v", test.name, err, test.wantErr)
+		} else if test.wantErr == nil && err == io.ErrUnexpectedEOF {
+			t.Errorf("%s: returned %v, want an error about the length", test.name, err)
+		}
+	}
+}
+
+func TestCSVCodecSingleField(t *testing.T) {
+	got, err := decodePairs(CSVCodec{}, "only value\nkey,value\n\"quoted, single\"\n\"\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pair{
+		{Key: "", Value: "only value"},
+		{Key: "key", Value: "value"},
+		{Key: "", Value: "quoted, single"},
+		{Key: "", Value: ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+
+	if _, err := decodePairs(CSVCodec{}, "a,b,c\n"); err == nil || !strings.Contains(err.Error(), "record 1") {
+		t.Errorf("reading a record of 3 fields returned %v, want an error naming record 1", err)
+	}
+}
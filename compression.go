@@ -0,0 +1,213 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression is a format resources can be transparently compressed with.
+type compression struct {
+	name      string
+	extension string
+	magic     []byte
+	newReader func(r io.Reader) (io.ReadCloser, error)
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var compressions = []*compression{
+	{
+		name:      "gzip",
+		extension: ".gz",
+		magic:     []byte{0x1f, 0x8b},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	},
+	{
+		name:      "zstd",
+		extension: ".zst",
+		magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+	},
+	{
+		name:      "snappy",
+		extension: ".snappy",
+		// The stream identifier chunk of the framing format.
+		magic: []byte("\xff\x06\x00\x00sNaPpY"),
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(snappy.NewReader(r)), nil
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return snappy.NewBufferedWriter(w), nil
+		},
+	},
+}
+
+// noCompression is the compression of resources created uncompressed.
+const noCompression = "none"
+
+// lookupCompression returns the compression named `name`, or nil if `name`
+// is empty or noCompression.
+func lookupCompression(name string) (*compression, error) {
+	if name == "" || name == noCompression {
+		return nil, nil
+	}
+	for _, c := range compressions {
+		if c.name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown compression: %s", name)
+}
+
+// compressionOfLocator returns the compression a locator indicates by its
+// extension, if any.
+func compressionOfLocator(locator string) *compression {
+	for _, c := range compressions {
+		if strings.HasSuffix(locator, c.extension) {
+			return c
+		}
+	}
+	return nil
+}
+
+// maxMagicLength is the length of the longest magic of compressions.
+const maxMagicLength = 16
+
+// compressionOfMagic returns the compression indicated by the magic bytes at
+// the beginning of `br`, if any, without consuming them.
+func compressionOfMagic(br *bufio.Reader) *compression {
+	for _, c := range compressions {
+		magic, _ := br.Peek(len(c.magic))
+		if bytes.Equal(magic, c.magic) {
+			return c
+		}
+	}
+	return nil
+}
+
+// decompress wraps `r`, the contents of `resource`, into a decompressing
+// reader if the resource is compressed. Resources created by
+// ResourceHint.Create record their compression. For others, such as inputs,
+// it is detected by the extension of the locator or else by the magic bytes
+// at the beginning of the contents, so that compressed inputs whose locators
+// do not have extensions are detected as well.
+func decompress(resource *Resource, r io.ReadCloser) (io.ReadCloser, error) {
+	var c *compression
+	br := bufio.NewReader(r)
+	if resource.Compression != "" {
+		var err error
+		if c, err = lookupCompression(resource.Compression); err != nil {
+			r.Close()
+			return nil, err
+		}
+	} else if c = compressionOfLocator(resource.Locator); c == nil {
+		c = compressionOfMagic(br)
+	}
+	if c == nil {
+		return &readCloser{Reader: br, Closer: r}, nil
+	}
+
+	d, err := c.newReader(br)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: d, Closer: multiCloser{d, r}}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() (err error) {
+	for _, c := range m {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return
+}
+
+// compressedResourceWriter compresses everything written to a resource.
+type compressedResourceWriter struct {
+	io.WriteCloser
+	resource    ResourceWriter
+	compression *compression
+}
+
+func (w *compressedResourceWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		_ = w.resource.Abort()
+		return err
+	}
+	return w.resource.Close()
+}
+
+func (w *compressedResourceWriter) Abort() error {
+	return w.resource.Abort()
+}
+
+func (w *compressedResourceWriter) Resource() *Resource {
+	return withCompression(w.resource.Resource(), w.compression.name)
+}
+
+// uncompressedResourceWriter records that a resource is not compressed, so
+// that it is never mistaken for a compressed one when read.
+type uncompressedResourceWriter struct {
+	ResourceWriter
+}
+
+func (w uncompressedResourceWriter) Resource() *Resource {
+	return withCompression(w.ResourceWriter.Resource(), noCompression)
+}
+
+func withCompression(resource *Resource, name string) *Resource {
+	if resource != nil {
+		resource.Compression = name
+	}
+	return resource
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tracing "github.com/ease-lab/vhive/utils/tracing/go"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCConfig configures the connections this process makes to workers, and
+// that workers make to each other for the XDT backend. Zero fields fall back
+// to the defaults of mare.
+type GRPCConfig struct {
+	// DialTimeout bounds the time it takes to connect to an address.
+	DialTimeout time.Duration
+	// KeepaliveTime is the period of inactivity after which a connection is
+	// pinged; it cannot be shorter than 10 seconds.
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is the time a ping is waited for before the
+	// connection is deemed broken.
+	KeepaliveTimeout time.Duration
+}
+
+const (
+	defaultGrpcDialTimeout      = 10 * time.Second
+	defaultGrpcKeepaliveTime    = 30 * time.Second
+	defaultGrpcKeepaliveTimeout = 10 * time.Second
+
+	// Workers close connections that ping more often than this.
+	minGrpcKeepaliveTime = 10 * time.Second
+)
+
+func (cfg GRPCConfig) dialTimeout() time.Duration {
+	if cfg.DialTimeout <= 0 {
+		return defaultGrpcDialTimeout
+	}
+	return cfg.DialTimeout
+}
+
+func (cfg GRPCConfig) keepaliveTime() time.Duration {
+	if cfg.KeepaliveTime <= 0 {
+		return defaultGrpcKeepaliveTime
+	}
+	if cfg.KeepaliveTime < minGrpcKeepaliveTime {
+		return minGrpcKeepaliveTime
+	}
+	return cfg.KeepaliveTime
+}
+
+func (cfg GRPCConfig) keepaliveTimeout() time.Duration {
+	if cfg.KeepaliveTimeout <= 0 {
+		return defaultGrpcKeepaliveTimeout
+	}
+	return cfg.KeepaliveTimeout
+}
+
+var (
+	grpcConfigMu sync.RWMutex
+	grpcConfig   GRPCConfig
+)
+
+// SetGRPCConfig replaces the GRPCConfig of this process. It only affects the
+// connections made afterwards.
+func SetGRPCConfig(cfg GRPCConfig) {
+	grpcConfigMu.Lock()
+	defer grpcConfigMu.Unlock()
+	grpcConfig = cfg
+}
+
+func getGrpcConfig() GRPCConfig {
+	grpcConfigMu.RLock()
+	defer grpcConfigMu.RUnlock()
+	return grpcConfig
+}
+
+// grpcConns pools connections by address, so that all invocations of a
+// worker share a single connection rather than dialing one each. Connections
+// are safe for concurrent use, and must not be closed by their users.
+var (
+	grpcConnsMu sync.Mutex
+	grpcConns   = make(map[string]*grpcConnEntry)
+)
+
+type grpcConnEntry struct {
+	once sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+// getGrpcConn returns the pooled connection to `address`, dialing it if need
+// be.
+func getGrpcConn(address string) (*grpc.ClientConn, error) {
+	grpcConnsMu.Lock()
+	entry, ok := grpcConns[address]
+	if !ok {
+		entry = new(grpcConnEntry)
+		grpcConns[address] = entry
+	}
+	grpcConnsMu.Unlock()
+
+	entry.once.Do(func() {
+		entry.conn, entry.err = dialGrpc(address, getGrpcConfig())
+	})
+	if entry.err != nil {
+		// Do not cache failures, e.g. of workers that are still starting.
+		grpcConnsMu.Lock()
+		if grpcConns[address] == entry {
+			delete(grpcConns, address)
+		}
+		grpcConnsMu.Unlock()
+		return nil, entry.err
+	}
+	return entry.conn, nil
+}
+
+func dialGrpc(address string, cfg GRPCConfig) (*grpc.ClientConn, error) {
+	dialOptions := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithInsecure(),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.keepaliveTime(),
+			Timeout:             cfg.keepaliveTimeout(),
+			PermitWithoutStream: true,
+		}),
+	}
+	if tracing.IsTracingEnabled() {
+		dialOptions = append(dialOptions, grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()))
+	}
+
+	// Not bound to the context of the caller, as the connection outlives it
+	// and is shared with others that may be waiting for it.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.dialTimeout())
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, address, dialOptions...)
+	if err != nil {
+		// Unavailable, so that the dial is retried like a failed invocation.
+		return nil, status.Errorf(codes.Unavailable, "failed to dial `%s`: %v", address, err)
+	}
+	return conn, nil
+}
+
+// grpcServerOptions returns the options of the servers of workers, which
+// have to tolerate the keepalive pings of pooled connections.
+func grpcServerOptions() []grpc.ServerOption {
+	serverOptions := []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             minGrpcKeepaliveTime,
+			PermitWithoutStream: true,
+		}),
+	}
+	if tracing.IsTracingEnabled() {
+		serverOptions = append(serverOptions, grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()))
+	}
+	return serverOptions
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+// Counters are named statistics reported by the workers, which the driver
+// sums over all tasks of a job, and by the driver itself.
+type Counters map[string]int64
+
+// Counters reported by MapBatch when a Combiner is set. Sizes are the total
+// length of keys and values, plus two separators per pair.
+const (
+	CounterCombineInputPairs  = "combine.inputPairs"
+	CounterCombineOutputPairs = "combine.outputPairs"
+	CounterCombineInputBytes  = "combine.inputBytes"
+	CounterCombineOutputBytes = "combine.outputBytes"
+)
+
+// Counters reported by the driver: the total time, in milliseconds, that the
+// tasks of each phase spent queued before being launched; see
+// WithMaxConcurrency.
+const (
+	CounterMapQueueMillis    = "map.queueMillis"
+	CounterReduceQueueMillis = "reduce.queueMillis"
+)
+
+func (c Counters) add(other map[string]int64) {
+	for name, value := range other {
+		c[name] += value
+	}
+}
+
+// pairsSize returns the size of `pairs` as counted by the counters.
+func pairsSize(pairs []Pair) (size int64) {
+	for _, pair := range pairs {
+		size += int64(len(pair.Key) + len(pair.Value) + 2)
+	}
+	return
+}
@@ -22,14 +22,17 @@ package mare
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"sort"
 
-	tracing "github.com/ease-lab/vhive/utils/tracing/go"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"google.golang.org/grpc"
 )
 
-
+// Drive runs a MapReduce job and returns the backend and the locator of its
+// final output. It calls logrus.Fatal if the job fails; use Run to handle
+// errors and to pass options instead.
 func Drive(
 	ctx context.Context,
 	workerURL,
@@ -40,137 +43,503 @@ func Drive(
 	outputHint string,
 	nReducers int,
 	inputLocators []string) (backend string, locator string) {
+	output, err := Run(ctx, workerURL, inputBack, interBack, interHint, outputBack, outputHint, nReducers, inputLocators)
+	if err != nil {
+		logrus.Fatal("Failed to drive: ", err)
+	}
+	return output.Backend.String(), output.Locator
+}
+
+// Run runs a MapReduce job and returns its final output. `workerURL` may be
+// a comma-separated list of endpoints, which tasks are spread across; see
+// WithWorkers and WithBalancing. Input locators may
+// be patterns, e.g. `inputs/*.tsv` or `s3://bucket/data/`, which are expanded
+// into the inputs they match; see WithInputFilter. Task failures are
+// reported as *JobError, naming the phase that failed; when invocations are
+// retried, its Err is a *RetryError listing every attempt. When a task fails,
+// all other in-flight tasks are cancelled through the context before Run
+// returns. With WithOutputParts, the returned resource is nil.
+func Run(
+	ctx context.Context,
+	workerURL,
+	inputBack,
+	interBack,
+	interHint,
+	outputBack,
+	outputHint string,
+	nReducers int,
+	inputLocators []string,
+	opts ...DriveOption) (*Resource, error) {
+	if nReducers < 1 {
+		return nil, fmt.Errorf("invalid number of reducers: %d", nReducers)
+	}
+	options := newDriveOptions(opts)
+
+	mapperURLs, reducerURLs := options.mapperURLs, options.reducerURLs
+	if len(mapperURLs) == 0 {
+		mapperURLs = splitURLs(workerURL)
+	}
+	if len(reducerURLs) == 0 {
+		reducerURLs = splitURLs(workerURL)
+	}
+	if len(mapperURLs) == 0 || len(reducerURLs) == 0 {
+		return nil, errors.New("no worker endpoints")
+	}
+	mappers := newEndpointPool("map", mapperURLs, options.balancing, options.health)
+	reducers := newEndpointPool("reduce", reducerURLs, options.balancing, options.health)
+	mapperCapabilities, err := mappers.checkCapabilities(ctx, func(c *CapabilitiesResponse) bool { return c.Map })
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reducers.checkCapabilities(ctx, func(c *CapabilitiesResponse) bool { return c.Reduce }); err != nil {
+		return nil, err
+	}
+	if err := checkPartitioners(options, mapperCapabilities); err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{options.inputCodec, options.interCodec, options.outputCodec} {
+		if _, err := LookupCodec(name); err != nil {
+			return nil, err
+		}
+	}
+	if interBack == ResourceBackend_XDT.String() {
+		if err := checkXDTHint(interHint, true); err != nil {
+			return nil, errors.Wrap(err, "invalid intermediate hint")
+		}
+	}
+	// Unless left as parts, reducer outputs are put together by the driver.
+	if outputBack == ResourceBackend_XDT.String() {
+		if err := checkXDTHint(outputHint, options.outputParts != nil); err != nil {
+			return nil, errors.Wrap(err, "invalid output hint")
+		}
+	}
+	for _, name := range []string{options.interCompression, options.outputCompression} {
+		if _, err := lookupCompression(name); err != nil {
+			return nil, err
+		}
+	}
+
+	inputBackend := ResourceBackend(ResourceBackend_value[inputBack])
+	span := MakeSpan("driver: map.list")
+	listCtx := StartSpan(span, ctx)
+	inputLocators, err = expandInputs(listCtx, inputBackend, inputLocators, &options.inputFilter)
+	EndSpan(span)
+	if err != nil {
+		return nil, err
+	}
+
 	var inputResources []*Resource
 	for _, locator := range inputLocators {
 		inputResources = append(inputResources, &Resource{
-			Backend: ResourceBackend(ResourceBackend_value[inputBack]),
+			Backend: inputBackend,
 			Locator: locator,
+			Codec:   options.inputCodec,
 		})
 	}
+	if options.splitSize > 0 {
+		span := MakeSpan("driver: map.split")
+		splitCtx := StartSpan(span, ctx)
+		splits, err := splitInputs(splitCtx, inputResources, options.splitSize)
+		EndSpan(span)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Debugf("Split %d inputs into %d splits...", len(inputResources), len(splits))
+		inputResources = splits
+	}
+
 	interResHint := ResourceHint{
-		Backend: ResourceBackend(ResourceBackend_value[interBack]),
-		Hint:    interHint,
+		Backend:     ResourceBackend(ResourceBackend_value[interBack]),
+		Hint:        interHint,
+		Codec:       options.interCodec,
+		Compression: options.interCompression,
 	}
 	outputResHint := ResourceHint{
-		Backend: ResourceBackend(ResourceBackend_value[outputBack]),
-		Hint:    outputHint,
+		Backend:     ResourceBackend(ResourceBackend_value[outputBack]),
+		Hint:        outputHint,
+		Codec:       options.outputCodec,
+		Compression: options.outputCompression,
+	}
+
+	nPartitions := 0
+	if options.shuffle == ShufflePartitioned {
+		nPartitions = nReducers
+	}
+
+	// Partitioned shuffles need the split points of total-order
+	// partitioning before the map phase.
+	var splitPoints []string
+	prePass := options.sampling != nil && (options.shuffle == ShufflePartitioned || options.sampling.PrePass)
+	if prePass {
+		samples, err := sampleInputs(ctx, mappers, inputResources, options)
+		if err != nil {
+			return nil, err
+		}
+		splitPoints = computeSplitPoints(samples, nReducers)
+		logrus.Debugf("Computed %d split points from %d sampled keys...", len(splitPoints), len(samples))
+		if len(splitPoints) == 0 && nPartitions > 0 {
+			// Mappers would fall back to their own partitioners, so make
+			// every key fall into the first partition instead.
+			nPartitions = 1
+		}
+	}
+
+	mapResponses, err := runMappers(ctx, mappers, inputResources, &interResHint, nPartitions, splitPoints, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unlike files and objects, XDT resources live in the memory of the
+	// workers, so release them as soon as they are no longer needed. The job
+	// may have failed because `ctx` is done, hence the background context.
+	if interResHint.Backend == ResourceBackend_XDT {
+		defer func() {
+			for _, mapResponse := range mapResponses {
+				if mapResponse.Output != nil {
+					discardOutput(context.Background(), mapResponse.Output)
+				}
+				discardPartitions(context.Background(), mapResponse.Partitions)
+			}
+		}()
 	}
 
-	keys, values := runMappers(ctx, workerURL, inputResources, &interResHint)
-	finalOutput := runReducers(ctx, workerURL, keys, nReducers, values, &outputResHint)
+	if options.counters != nil {
+		for _, mapResponse := range mapResponses {
+			options.counters.add(mapResponse.Counters)
+		}
+	}
 
-	return finalOutput.Backend.String(), finalOutput.Locator
+	var reduceRequests []*ReduceBatchRequest
+	if options.shuffle == ShufflePartitioned {
+		reduceRequests = partitionedReduceRequests(mapResponses, nReducers)
+	} else {
+		partitioner := options.partitioner
+		if options.sampling != nil {
+			if !prePass {
+				samples := sampleMapKeys(mapResponses, options.sampling.sampleSize())
+				splitPoints = computeSplitPoints(samples, nReducers)
+				logrus.Debugf("Computed %d split points from %d sampled keys...", len(splitPoints), len(samples))
+			}
+			partitioner = RangePartitioner{SplitPoints: splitPoints}
+		}
+		reduceRequests, err = keyedReduceRequests(mapResponses, nReducers, partitioner, options.sorted || options.sampling != nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to split keys")
+		}
+	}
+	return runReducers(ctx, reducers, reduceRequests, &outputResHint, options)
 }
 
-func runMappers(ctx context.Context, workerURL string, inputSlices []*Resource, outputHint *ResourceHint) (keys []string, values []*Resource) {
-	outputCh := make(chan *MapBatchResponse)
+// checkPartitioners checks that keys are split by the partitioner the job
+// was configured with, given the capabilities of the mappers. Total-order
+// partitioning overrides the partitioners of both the driver and the
+// workers.
+func checkPartitioners(options *driveOptions, mapperCapabilities []*CapabilitiesResponse) error {
+	if options.sampling != nil {
+		return nil
+	}
+	switch options.shuffle {
+	case ShuffleKeys:
+		// Keys are split by the driver, which does not know the partitioners
+		// of the workers.
+		if options.partitioner != nil {
+			return nil
+		}
+		for _, c := range mapperCapabilities {
+			if c.CustomPartitioner {
+				return errors.New("workers have a custom partitioner, which keyed shuffles do not use; pass it to WithPartitioner as well, or use ShufflePartitioned")
+			}
+		}
+	case ShufflePartitioned:
+		// Keys are split by the workers, so a partitioner given to the
+		// driver is only honoured if the workers have it too.
+		if options.partitioner == nil {
+			return nil
+		}
+		_, isDefault := options.partitioner.(HashPartitioner)
+		for _, c := range mapperCapabilities {
+			if c.CustomPartitioner == isDefault {
+				return errors.New("partitioned shuffles split keys with the partitioners of the workers, which differ from the one passed to WithPartitioner; pass it to WorkPartitioner as well")
+			}
+		}
+	}
+	return nil
+}
+
+// runMappers maps every input slice. If `nPartitions` is non-zero, outputs
+// are partitioned, by `splitPoints` if any.
+func runMappers(ctx context.Context, mappers *endpointPool, inputSlices []*Resource, outputHint *ResourceHint, nPartitions int, splitPoints []string, options *driveOptions) ([]*MapBatchResponse, error) {
+	tasks := make([]task, len(inputSlices))
+	for i, inputSlice := range inputSlices {
+		request := &MapBatchRequest{
+			Input:       inputSlice,
+			OutputHint:  outputHint,
+			NPartitions: int32(nPartitions),
+		}
+		if nPartitions > 0 {
+			request.SplitPoints = splitPoints
+		}
+		tasks[i] = task{
+			run: func(ctx context.Context) (interface{}, error) {
+				var resp *MapBatchResponse
+				err := options.retry.do(ctx, "driver: map.invoke", func(ctx context.Context) (err error) {
+					mapper := mappers.acquire()
+					resp, err = invokeMapper(ctx, mapper.url, request)
+					mappers.release(ctx, mapper, err)
+					return
+				})
+				return resp, err
+			},
+			discard: func(ctx context.Context, result interface{}) {
+				resp := result.(*MapBatchResponse)
+				if resp.Output != nil {
+					discardOutput(ctx, resp.Output)
+				}
+				discardPartitions(ctx, resp.Partitions)
+			},
+		}
+	}
 
 	span := MakeSpan("driver: reduce.invokeAllMappers")
 	ctx = StartSpan(span, ctx)
-	for _, inputSlice := range inputSlices {
-		go invokeMapper(ctx, workerURL, inputSlice, outputHint, outputCh)
-	}
+	results, err := runTasks(ctx, "map", tasks, schedule{
+		speculation:    options.speculation,
+		maxConcurrency: options.maxMaps,
+		counters:       options.counters,
+	})
 	EndSpan(span)
+	if err != nil {
+		taskErr := err.(*taskError)
+		return nil, &JobError{Phase: PhaseMap, Input: inputSlices[taskErr.index], Err: taskErr.err}
+	}
 
+	responses := make([]*MapBatchResponse, len(results))
+	for i, result := range results {
+		responses[i] = result.(*MapBatchResponse)
+	}
+	return responses, nil
+}
+
+func invokeMapper(ctx context.Context, workerURL string, request *MapBatchRequest) (*MapBatchResponse, error) {
+	conn, err := getGrpcConn(workerURL)
+	if err != nil {
+		return nil, err
+	}
+	client := NewMareClient(conn)
+
+	resp, err := client.MapBatch(ctx, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to invoke map batch")
+	}
+	return resp, nil
+}
+
+// keyedReduceRequests splits the union of the keys returned by the mappers
+// among `nReducers` reducers, each of which reads every mapper output. Keys
+// are split by `partitioner` if it is not nil. If `sorted` is set, every
+// reducer is given its keys in sorted order.
+func keyedReduceRequests(mapResponses []*MapBatchResponse, nReducers int, partitioner Partitioner, sorted bool) ([]*ReduceBatchRequest, error) {
+	var values []*Resource
 	keysMap := make(map[string]interface{})
-	for i := 0; i < len(inputSlices); i++ {
-		mapBatchResponse := <-outputCh
+	for _, mapBatchResponse := range mapResponses {
 		// To get a set of unique keys
 		for _, key := range mapBatchResponse.Keys {
 			keysMap[key] = nil
 		}
 		values = append(values, mapBatchResponse.Output)
 	}
-	keys = MapKeys(keysMap)
-	return
-}
 
-func invokeMapper(ctx context.Context, workerURL string, input *Resource, outputHint *ResourceHint, outputCh chan<- *MapBatchResponse) {
-	conn := getGrpcConn(workerURL)
-	defer conn.Close()
-	client := NewMareClient(conn)
-
-	resp, err := client.MapBatch(ctx, &MapBatchRequest{
-		Input:      input,
-		OutputHint: outputHint,
-	})
-	if err != nil {
-		logrus.Fatal("Failed to invoke map batch: ", err)
+	keys := MapKeys(keysMap)
+	if sorted {
+		sort.Strings(keys)
+	}
+	var keysets [][]string
+	if partitioner != nil {
+		var err error
+		if keysets, err = partitionKeys(partitioner, keys, nReducers); err != nil {
+			return nil, err
+		}
+	} else {
+		keysets = splitKeys(keys, nReducers)
 	}
 
-	outputCh <- resp
+	var requests []*ReduceBatchRequest
+	for _, keyset := range keysets {
+		requests = append(requests, &ReduceBatchRequest{
+			Keys:   keyset,
+			Inputs: values,
+		})
+	}
+	return requests, nil
 }
 
-func runReducers(ctx context.Context, workerURL string, keys []string, nReducers int, values []*Resource, outputHint *ResourceHint) *Resource {
-	outputCh := make(chan *Resource)
+// partitionedReduceRequests makes reducer i read partition i of every mapper
+// output.
+func partitionedReduceRequests(mapResponses []*MapBatchResponse, nReducers int) []*ReduceBatchRequest {
+	requests := make([]*ReduceBatchRequest, nReducers)
+	for i := range requests {
+		requests[i] = &ReduceBatchRequest{AllKeys: true}
+	}
+	for _, mapBatchResponse := range mapResponses {
+		for i, partition := range mapBatchResponse.Partitions {
+			if partition.Backend != ResourceBackend_NULL {
+				requests[i].Inputs = append(requests[i].Inputs, partition)
+			}
+		}
+	}
+	return requests
+}
 
-	keysets := splitKeys(keys, nReducers)
+func runReducers(ctx context.Context, reducers *endpointPool, requests []*ReduceBatchRequest, outputHint *ResourceHint, options *driveOptions) (*Resource, error) {
+	tasks := make([]task, len(requests))
+	for i, request := range requests {
+		request := request
+		request.OutputHint = outputHint
+		tasks[i] = task{
+			run: func(ctx context.Context) (interface{}, error) {
+				var output *Resource
+				err := options.retry.do(ctx, "driver: reduce.invoke", func(ctx context.Context) (err error) {
+					reducer := reducers.acquire()
+					output, err = invokeReducer(ctx, reducer.url, request)
+					reducers.release(ctx, reducer, err)
+					return
+				})
+				return output, err
+			},
+			discard: func(ctx context.Context, result interface{}) {
+				discardOutput(ctx, result.(*Resource))
+			},
+		}
+	}
 
 	spanInvoke := MakeSpan("driver: reduce.invokeAllReducers")
 	ctx = StartSpan(spanInvoke, ctx)
-	for _, keyset := range keysets {
-		go invokeReducer(ctx, workerURL, keyset, values, outputHint, outputCh)
-	}
+	results, err := runTasks(ctx, "reduce", tasks, schedule{
+		speculation:    options.speculation,
+		maxConcurrency: options.maxReduces,
+		counters:       options.counters,
+	})
 	EndSpan(spanInvoke)
-
-	spanGet := MakeSpan("driver: reduce.get")
-	ctx = StartSpan(spanGet, ctx)
-	var outputDatas []string
-	for i := 0; i < len(keysets); i++ {
-		outputData, err := (<-outputCh).Get(ctx)
-		if err != nil {
-			logrus.Fatal("Failed to get reducer output: ", err)
-		}
-		outputDatas = append(outputDatas, outputData)
+	if err != nil {
+		taskErr := err.(*taskError)
+		return nil, &JobError{Phase: PhaseReduce, Partition: taskErr.index, Keys: requests[taskErr.index].Keys, Err: taskErr.err}
 	}
-	EndSpan(spanGet)
 
-	spanUnmarshalCatMarshal := MakeSpan("driver: reduce.unmarshal-cat-marshal")
-	ctx = StartSpan(spanUnmarshalCatMarshal, ctx)
-	var outputPairs []Pair
-	for _, outputData := range outputDatas {
-		outputPairs = append(outputPairs, UnmarshalPairs(outputData)...)
+	outputs := make([]*Resource, len(results))
+	for i, result := range results {
+		outputs[i] = result.(*Resource)
+	}
+	if options.outputParts != nil {
+		*options.outputParts = outputs
+		return nil, nil
+	}
+	if outputHint.Backend == ResourceBackend_XDT {
+		defer func() {
+			for _, reducerOutput := range outputs {
+				discardOutput(context.Background(), reducerOutput)
+			}
+		}()
+	}
+	// With total-order partitioning, the concatenation of the sorted outputs
+	// is sorted already.
+	if options.sorted && options.sampling == nil {
+		return mergeOutputs(ctx, outputs, outputHint)
 	}
-	finalOutput := MarshalPairs(outputPairs)
-	EndSpan(spanUnmarshalCatMarshal)
 
-	spanPut := MakeSpan("driver: reduce.put")
-	ctx = StartSpan(spanPut, ctx)
-	output, err := outputHint.Put(ctx, finalOutput)
+	spanCat := MakeSpan("driver: reduce.get-cat-put")
+	ctx = StartSpan(spanCat, ctx)
+	output, err := createPairResource(ctx, outputHint)
 	if err != nil {
-		logrus.Fatal("Failed to put final output: ", err)
+		return nil, &JobError{Phase: PhasePut, Err: errors.Wrap(err, "failed to create final output")}
 	}
-	EndSpan(spanPut)
+	for _, reducerOutput := range outputs {
+		if err := readPairs(ctx, reducerOutput, false, output.Write); err != nil {
+			output.Abort()
+			return nil, &JobError{Phase: PhasePut, Input: reducerOutput, Err: errors.Wrap(err, "failed to concatenate reducer output")}
+		}
+	}
+	finalOutput, err := output.Close()
+	if err != nil {
+		return nil, &JobError{Phase: PhasePut, Err: errors.Wrap(err, "failed to put final output")}
+	}
+	EndSpan(spanCat)
 
-	return output
+	return finalOutput, nil
 }
 
-func invokeReducer(ctx context.Context, workerURL string, keyset []string, values []*Resource, outputHint *ResourceHint, outputCh chan<- *Resource) {
-	conn := getGrpcConn(workerURL)
-	defer conn.Close()
-	client := NewMareClient(conn)
+// mergeOutputs k-way merges the sorted outputs of the reducers by key into
+// the final output.
+func mergeOutputs(ctx context.Context, outputs []*Resource, outputHint *ResourceHint) (*Resource, error) {
+	span := MakeSpan("driver: reduce.get-merge-put")
+	ctx = StartSpan(span, ctx)
+	defer EndSpan(span)
 
-	resp, err := client.ReduceBatch(ctx, &ReduceBatchRequest{
-		Keys:       keyset,
-		Inputs:     values,
-		OutputHint: outputHint,
-	})
+	cursors := make([]*pairCursor, 0, len(outputs))
+	for i, reducerOutput := range outputs {
+		r, err := reducerOutput.Open(ctx)
+		if err != nil {
+			(&pairMerger{cursors: cursors}).Close()
+			return nil, &JobError{Phase: PhasePut, Input: reducerOutput, Err: errors.Wrap(err, "failed to open reducer output")}
+		}
+		reader, err := newPairReader(reducerOutput, r, false)
+		if err != nil {
+			r.Close()
+			(&pairMerger{cursors: cursors}).Close()
+			return nil, &JobError{Phase: PhasePut, Input: reducerOutput, Err: err}
+		}
+		cursors = append(cursors, &pairCursor{rank: i, reader: reader, closer: r})
+	}
+	merger, err := newPairMerger(cursors)
 	if err != nil {
-		logrus.Fatal("Failed to invoke reduce batch: ", err)
+		return nil, &JobError{Phase: PhasePut, Err: errors.Wrap(err, "failed to merge reducer outputs")}
+	}
+	defer merger.Close()
+
+	output, err := createPairResource(ctx, outputHint)
+	if err != nil {
+		return nil, &JobError{Phase: PhasePut, Err: errors.Wrap(err, "failed to create final output")}
+	}
+	for {
+		pair, err := merger.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			output.Abort()
+			return nil, &JobError{Phase: PhasePut, Err: errors.Wrap(err, "failed to merge reducer outputs")}
+		}
+		if err := output.Write(pair); err != nil {
+			output.Abort()
+			return nil, &JobError{Phase: PhasePut, Err: errors.Wrap(err, "failed to write final output")}
+		}
 	}
-	outputCh <- resp.Output
+	finalOutput, err := output.Close()
+	if err != nil {
+		return nil, &JobError{Phase: PhasePut, Err: errors.Wrap(err, "failed to put final output")}
+	}
+	return finalOutput, nil
 }
 
-func getGrpcConn(workerURL string) *grpc.ClientConn {
-	dialOptions := []grpc.DialOption{grpc.WithBlock(), grpc.WithInsecure()}
-	if tracing.IsTracingEnabled() {
-		dialOptions = append(dialOptions, grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()))
+func invokeReducer(ctx context.Context, workerURL string, request *ReduceBatchRequest) (*Resource, error) {
+	conn, err := getGrpcConn(workerURL)
+	if err != nil {
+		return nil, err
 	}
-	conn, err := grpc.Dial(workerURL, dialOptions...)
+	client := NewMareClient(conn)
+
+	resp, err := client.ReduceBatch(ctx, request)
 	if err != nil {
-		logrus.Fatal("Failed to dial: ", err)
+		return nil, errors.Wrap(err, "failed to invoke reduce batch")
+	}
+	return resp.Output, nil
+}
+
+// discardOutput deletes an output that is no longer needed, e.g. that of a
+// losing speculative attempt.
+func discardOutput(ctx context.Context, output *Resource) {
+	if err := output.Delete(ctx); err != nil {
+		logrus.Warnf("Failed to discard `%s`: %v", output.Locator, err)
 	}
-	return conn
 }
 
 func splitKeys(keys []string, n int) [][]string {
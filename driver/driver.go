@@ -24,21 +24,139 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
 
 	"github.com/ease-lab/mare"
 )
 
 func main() {
-	workerURL := flag.String("workerURL", "127.0.0.1:8080", "URL of the mapper/reducer workers including the port number")
+	workerURL := flag.String("workerURL", "127.0.0.1:8080", "Comma-separated URLs of the mapper/reducer workers including the port number")
+	mapperURLs := flag.String("mapperURLs", "", "Comma-separated URLs of the mapper workers, if different from workerURL.")
+	reducerURLs := flag.String("reducerURLs", "", "Comma-separated URLs of the reducer workers, if different from workerURL.")
+	balancing := flag.String("balancing", "round-robin", "How tasks are spread across workers. Either one of \"round-robin\" or \"least-outstanding\".")
 	inputResourceBackend := flag.String("inputResourceBackend", "FILE", "Backend of the input resource. Either one of \"FILE\", \"S3\", or \"XDT\".")
-	interBack := flag.String("interBack", "FILE", "Backend of the intermediate resources.")
+	interBack := flag.String("interBack", "FILE", "Backend of the intermediate resources. XDT keeps them in the memory of the workers.")
 	interHint := flag.String("interHint", "", "Hint for the intermediate resources.")
 	outputBack := flag.String("outputBack", "FILE", "Backend of the final output resources.")
 	outputHint := flag.String("outputHint", "", "Hint for the final output resources.")
 	nReducers := flag.Int("nReducers", 5, "Number of reducer invocations.")
+	maxAttempts := flag.Int("maxAttempts", 1, "Maximum number of attempts per map/reduce invocation.")
+	initialBackoff := flag.Duration("initialBackoff", 200*time.Millisecond, "Delay before retrying a failed invocation.")
+	maxBackoff := flag.Duration("maxBackoff", 10*time.Second, "Maximum delay between two attempts of an invocation.")
+	speculationThreshold := flag.Float64("speculationThreshold", 0, "Fraction of tasks that must finish before stragglers are duplicated; 0 disables speculative execution.")
+	inputInclude := flag.String("inputInclude", "", "Comma-separated glob patterns; inputs that input patterns expand into are mapped only if their base names match one of them.")
+	inputExclude := flag.String("inputExclude", "", "Comma-separated glob patterns; inputs that input patterns expand into are skipped if their base names match one of them.")
+	maxMaps := flag.Int("maxMaps", 0, "Maximum number of map invocations in flight at a time; 0 for no limit.")
+	maxReduces := flag.Int("maxReduces", 0, "Maximum number of reduce invocations in flight at a time; 0 for no limit.")
+	splitSize := flag.Int64("splitSize", 0, "Target size in bytes of the splits large inputs are split into; 0 disables splitting.")
+	sortedOutput := flag.Bool("sortedOutput", false, "Sort the final output by key.")
+	outputParts := flag.Bool("outputParts", false, "Leave the outputs of the reducers as part files, and print their locators in order instead of that of a final output.")
+	totalOrder := flag.Bool("totalOrder", false, "Range partition keys by split points computed from a sample of them, so that the final output is sorted by key.")
+	sampleSize := flag.Int("sampleSize", 0, "Number of keys sampled per map task for totalOrder; 0 for the default.")
+	sampleRecords := flag.Int("sampleRecords", 0, "Number of input pairs per input mapped in the sampling pre-pass; 0 for the default, negative for all.")
+	samplePrePass := flag.Bool("samplePrePass", false, "Sample keys in a pre-pass over the inputs even in keyed shuffles.")
+	shuffle := flag.String("shuffle", "keys", "Shuffle mode. Either one of \"keys\" or \"partitioned\".")
+	inputCodec := flag.String("inputCodec", "tsv", "Codec of the input resources. Either one of \"tsv\", \"jsonl\", \"binary\", or \"csv\".")
+	interCodec := flag.String("interCodec", "tsv", "Codec of the intermediate resources.")
+	outputCodec := flag.String("outputCodec", "tsv", "Codec of the final output resources.")
+	interCompression := flag.String("interCompression", "", "Compression of the intermediate resources. Either one of \"gzip\", \"zstd\", or \"snappy\"; none if empty.")
+	outputCompression := flag.String("outputCompression", "", "Compression of the final output resources.")
+	dialTimeout := flag.Duration("dialTimeout", 10*time.Second, "Maximum time to connect to a worker.")
+	keepaliveTime := flag.Duration("keepaliveTime", 30*time.Second, "Period of inactivity after which connections to workers are pinged.")
+	s3Endpoint := flag.String("s3Endpoint", "", "URL of an S3-compatible server to use instead of AWS. Defaults to MARE_S3_ENDPOINT.")
+	s3Region := flag.String("s3Region", "", "Region of the S3 backend. Defaults to MARE_S3_REGION.")
+	s3PathStyle := flag.Bool("s3PathStyle", false, "Address S3 buckets by path rather than by hostname. Defaults to MARE_S3_PATH_STYLE.")
+	s3AccessKeyID := flag.String("s3AccessKeyID", "", "Access key ID of the S3 backend. Defaults to MARE_S3_ACCESS_KEY_ID.")
+	s3SecretAccessKey := flag.String("s3SecretAccessKey", "", "Secret access key of the S3 backend. Defaults to MARE_S3_SECRET_ACCESS_KEY.")
+	s3MultipartThreshold := flag.Int64("s3MultipartThreshold", 0, "Size in bytes above which S3 objects are uploaded in parts. Defaults to MARE_S3_MULTIPART_THRESHOLD, or 64 MiB.")
+	s3PartSize := flag.Int64("s3PartSize", 0, "Size in bytes of the parts S3 objects are uploaded and downloaded in. Defaults to MARE_S3_PART_SIZE, or 16 MiB.")
+	s3Concurrency := flag.Int("s3Concurrency", 0, "Number of parts of an S3 object to transfer at a time. Defaults to MARE_S3_CONCURRENCY, or 4.")
 	flag.Parse()
 
-	_, locator := mare.Drive(
+	mare.SetGRPCConfig(mare.GRPCConfig{
+		DialTimeout:   *dialTimeout,
+		KeepaliveTime: *keepaliveTime,
+	})
+
+	// The workers read the same settings from their environment.
+	s3Config := mare.S3ConfigFromEnv()
+	if *s3Endpoint != "" {
+		s3Config.Endpoint = *s3Endpoint
+	}
+	if *s3Region != "" {
+		s3Config.Region = *s3Region
+	}
+	if *s3PathStyle {
+		s3Config.UsePathStyle = true
+	}
+	if *s3AccessKeyID != "" {
+		s3Config.AccessKeyID = *s3AccessKeyID
+		s3Config.SecretAccessKey = *s3SecretAccessKey
+	}
+	if *s3MultipartThreshold > 0 {
+		s3Config.MultipartThreshold = *s3MultipartThreshold
+	}
+	if *s3PartSize > 0 {
+		s3Config.PartSize = *s3PartSize
+	}
+	if *s3Concurrency > 0 {
+		s3Config.Concurrency = *s3Concurrency
+	}
+	mare.SetS3Config(s3Config)
+
+	retryPolicy := mare.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = *maxAttempts
+	retryPolicy.InitialBackoff = *initialBackoff
+	retryPolicy.MaxBackoff = *maxBackoff
+
+	counters := make(mare.Counters)
+	opts := []mare.DriveOption{
+		mare.WithRetryPolicy(retryPolicy),
+		mare.WithCounters(counters),
+		mare.WithCodecs(*inputCodec, *interCodec, *outputCodec),
+		mare.WithCompression(*interCompression, *outputCompression),
+		mare.WithSplitSize(*splitSize),
+		mare.WithMaxConcurrency(*maxMaps, *maxReduces),
+		mare.WithWorkers(splitList(*mapperURLs), splitList(*reducerURLs)),
+		mare.WithInputFilter(splitList(*inputInclude), splitList(*inputExclude)),
+	}
+	switch *balancing {
+	case "round-robin":
+	case "least-outstanding":
+		opts = append(opts, mare.WithBalancing(mare.BalanceLeastOutstanding))
+	default:
+		logrus.Fatalf("Unknown balancing: %s", *balancing)
+	}
+	switch *shuffle {
+	case "keys":
+	case "partitioned":
+		opts = append(opts, mare.WithShuffle(mare.ShufflePartitioned))
+	default:
+		logrus.Fatalf("Unknown shuffle mode: %s", *shuffle)
+	}
+	if *sortedOutput {
+		opts = append(opts, mare.WithSortedOutput())
+	}
+	if *totalOrder {
+		opts = append(opts, mare.WithTotalOrder(mare.SamplingPolicy{
+			SampleSize:    *sampleSize,
+			SampleRecords: *sampleRecords,
+			PrePass:       *samplePrePass,
+		}))
+	}
+	var parts []*mare.Resource
+	if *outputParts {
+		opts = append(opts, mare.WithOutputParts(&parts))
+	}
+	if *speculationThreshold > 0 {
+		opts = append(opts, mare.WithSpeculation(mare.SpeculationPolicy{Threshold: *speculationThreshold}))
+	}
+
+	output, err := mare.Run(
 		context.Background(),
 		*workerURL,
 		*inputResourceBackend,
@@ -48,7 +166,35 @@ func main() {
 		*outputHint,
 		*nReducers,
 		flag.Args(),
+		opts...,
 	)
 
-	fmt.Println(locator)
+	if err != nil {
+		logrus.Fatal("Failed to run: ", err)
+	}
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		logrus.Infof("%s: %d", name, counters[name])
+	}
+
+	if *outputParts {
+		for _, part := range parts {
+			fmt.Println(part.Locator)
+		}
+		return
+	}
+	fmt.Println(output.Locator)
+}
+
+// splitList splits a comma-separated list.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
 }
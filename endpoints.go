@@ -0,0 +1,262 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Balancing selects how tasks are spread across the worker endpoints of a
+// phase.
+type Balancing int
+
+const (
+	// BalanceRoundRobin sends tasks to the endpoints in turn.
+	BalanceRoundRobin Balancing = iota
+	// BalanceLeastOutstanding sends every task to the endpoint with the
+	// fewest invocations in flight, in turn among equals.
+	BalanceLeastOutstanding
+)
+
+// HealthPolicy configures when worker endpoints are deemed unhealthy. An
+// endpoint whose invocations fail MaxFailures times in a row is not sent
+// any tasks for Cooldown, unless all endpoints are unhealthy; after that, it
+// is sent tasks again, and deemed unhealthy again as soon as one fails.
+// Only failures of the endpoint itself count, i.e. invocations that fail as
+// Unavailable, DeadlineExceeded or ResourceExhausted; neither errors of the
+// tasks, such as missing inputs, nor invocations that the driver cancels
+// itself do.
+type HealthPolicy struct {
+	MaxFailures int
+	Cooldown    time.Duration
+}
+
+const (
+	defaultMaxEndpointFailures = 3
+	defaultEndpointCooldown    = 30 * time.Second
+)
+
+func (p HealthPolicy) maxFailures() int {
+	if p.MaxFailures <= 0 {
+		return defaultMaxEndpointFailures
+	}
+	return p.MaxFailures
+}
+
+func (p HealthPolicy) cooldown() time.Duration {
+	if p.Cooldown <= 0 {
+		return defaultEndpointCooldown
+	}
+	return p.Cooldown
+}
+
+// splitURLs splits a comma-separated list of endpoint URLs.
+func splitURLs(urls string) []string {
+	var split []string
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			split = append(split, url)
+		}
+	}
+	return split
+}
+
+// endpointPool spreads the tasks of a phase across worker endpoints.
+type endpointPool struct {
+	phase     string
+	balancing Balancing
+	health    HealthPolicy
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+type endpoint struct {
+	url            string
+	outstanding    int
+	failures       int
+	unhealthyUntil time.Time
+}
+
+func newEndpointPool(phase string, urls []string, balancing Balancing, health HealthPolicy) *endpointPool {
+	p := &endpointPool{phase: phase, balancing: balancing, health: health}
+	for _, url := range urls {
+		p.endpoints = append(p.endpoints, &endpoint{url: url})
+	}
+	return p
+}
+
+// acquire picks the endpoint to send an invocation to, among the healthy
+// ones if there are any. It must be released once the invocation is over.
+func (p *endpointPool) acquire() *endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var chosen *endpoint
+	// Start from the turn of the next endpoint, so that ties are broken in
+	// a round-robin fashion.
+	for j := range p.endpoints {
+		e := p.endpoints[(p.next+j)%len(p.endpoints)]
+		if e.isUnhealthy(now, p.health) {
+			continue
+		}
+		if chosen == nil || (p.balancing == BalanceLeastOutstanding && e.outstanding < chosen.outstanding) {
+			chosen = e
+		}
+		if p.balancing == BalanceRoundRobin {
+			break
+		}
+	}
+	if chosen == nil {
+		// All are unhealthy: try the one that is to recover first.
+		for _, e := range p.endpoints {
+			if chosen == nil || e.unhealthyUntil.Before(chosen.unhealthyUntil) {
+				chosen = e
+			}
+		}
+	}
+
+	for i, e := range p.endpoints {
+		if e == chosen {
+			p.next = (i + 1) % len(p.endpoints)
+		}
+	}
+	chosen.outstanding++
+	return chosen
+}
+
+// release records the outcome of an invocation made with `ctx` to `e`.
+func (p *endpointPool) release(ctx context.Context, e *endpoint, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.outstanding--
+	if err == nil {
+		e.failures = 0
+		return
+	}
+	if ctx.Err() != nil {
+		// Cancelled by the driver, e.g. in favour of a speculative
+		// duplicate; says nothing about the endpoint.
+		return
+	}
+	if !isEndpointFailure(err) {
+		// The endpoint served the invocation, which failed on its own.
+		return
+	}
+	now := time.Now()
+	wasUnhealthy := e.isUnhealthy(now, p.health)
+	e.failures++
+	if e.failures >= p.health.maxFailures() {
+		e.unhealthyUntil = now.Add(p.health.cooldown())
+	}
+	if !wasUnhealthy && e.isUnhealthy(now, p.health) {
+		logrus.Warnf("Marking %s endpoint `%s` unhealthy for %v after %d failures in a row: %v",
+			p.phase, e.url, p.health.cooldown(), e.failures, err)
+	}
+}
+
+// isEndpointFailure reports whether `err` says that an endpoint could not be
+// reached or could not serve an invocation, rather than that the invocation
+// itself failed.
+func isEndpointFailure(err error) bool {
+	switch status.Code(errors.Cause(err)) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// checkCapabilities asks every endpoint whether it serves the phase, as
+// reported by `serves`, and removes those that do not. Endpoints that cannot
+// be asked are kept, leaving it to their invocations to fail. It returns the
+// capabilities of the endpoints kept that could be asked, and fails if no
+// endpoint is left.
+func (p *endpointPool) checkCapabilities(ctx context.Context, serves func(*CapabilitiesResponse) bool) ([]*CapabilitiesResponse, error) {
+	kept := make([]bool, len(p.endpoints))
+	capabilities := make([]*CapabilitiesResponse, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+			c, err := getCapabilities(ctx, e.url)
+			if err != nil {
+				logrus.Warnf("Failed to get the capabilities of %s endpoint `%s`: %v", p.phase, e.url, err)
+				kept[i] = true
+				return
+			}
+			kept[i] = serves(c)
+			capabilities[i] = c
+			if !kept[i] {
+				logrus.Warnf("Skipping %s endpoint `%s`, which does not serve %s tasks", p.phase, e.url, p.phase)
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var endpoints []*endpoint
+	var keptCapabilities []*CapabilitiesResponse
+	for i, e := range p.endpoints {
+		if kept[i] {
+			endpoints = append(endpoints, e)
+			if capabilities[i] != nil {
+				keptCapabilities = append(keptCapabilities, capabilities[i])
+			}
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoint serves %s tasks", p.phase)
+	}
+	p.endpoints = endpoints
+	p.next = 0
+	return keptCapabilities, nil
+}
+
+func getCapabilities(ctx context.Context, workerURL string) (*CapabilitiesResponse, error) {
+	conn, err := getGrpcConn(workerURL)
+	if err != nil {
+		return nil, err
+	}
+	capabilities, err := NewMareClient(conn).Capabilities(ctx, &CapabilitiesRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		// Workers that predate Capabilities serve both.
+		return &CapabilitiesResponse{Map: true, Reduce: true}, nil
+	}
+	return capabilities, err
+}
+
+func (e *endpoint) isUnhealthy(now time.Time, health HealthPolicy) bool {
+	return e.failures >= health.maxFailures() && now.Before(e.unhealthyUntil)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEndpointPoolHealth(t *testing.T) {
+	ctx := context.Background()
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		err           error
+		wantUnhealthy bool
+	}{
+		{"unavailable", ctx, errors.Wrap(status.Error(codes.Unavailable, "down"), "failed to invoke map batch"), true},
+		{"deadline exceeded", ctx, status.Error(codes.DeadlineExceeded, "slow"), true},
+		{"resource exhausted", ctx, status.Error(codes.ResourceExhausted, "overloaded"), true},
+		{"mapper error", ctx, errors.Wrap(status.Error(codes.Unknown, "failed to map"), "failed to invoke map batch"), false},
+		{"missing input", ctx, status.Error(codes.Unknown, "no such file"), false},
+		{"not a status", ctx, errors.New("failed"), false},
+		{"cancelled by the driver", cancelledCtx, status.Error(codes.Canceled, "cancelled"), false},
+	}
+	for _, test := range tests {
+		pool := newEndpointPool("map", []string{"a", "b"}, BalanceRoundRobin, HealthPolicy{MaxFailures: 2, Cooldown: time.Hour})
+		for i := 0; i < 2; i++ {
+			e := pool.acquire()
+			if e.url != "a" {
+				t.Fatalf("%s: acquired `%s`, want `a`", test.name, e.url)
+			}
+			pool.release(test.ctx, e, test.err)
+			pool.release(ctx, pool.acquire(), nil)
+		}
+
+		unhealthy := pool.endpoints[0].isUnhealthy(time.Now(), pool.health)
+		if unhealthy != test.wantUnhealthy {
+			t.Errorf("%s: endpoint unhealthy = %v, want %v", test.name, unhealthy, test.wantUnhealthy)
+		}
+		if got := pool.acquire(); unhealthy && got.url != "b" {
+			t.Errorf("%s: acquired unhealthy endpoint `%s`", test.name, got.url)
+		}
+	}
+}
+
+func TestEndpointPoolAllUnhealthy(t *testing.T) {
+	pool := newEndpointPool("reduce", []string{"a", "b"}, BalanceLeastOutstanding, HealthPolicy{MaxFailures: 1, Cooldown: time.Hour})
+	unavailable := status.Error(codes.Unavailable, "down")
+	pool.release(context.Background(), pool.acquire(), unavailable)
+	pool.release(context.Background(), pool.acquire(), unavailable)
+
+	// The endpoint that is to recover first is tried.
+	if got := pool.acquire(); got.url != "a" {
+		t.Errorf("acquired `%s`, want `a`", got.url)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"fmt"
+)
+
+// Phase identifies the stage of a job that an error originated from.
+type Phase int
+
+const (
+	PhaseMap Phase = iota
+	PhaseReduce
+	PhasePut
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseMap:
+		return "map"
+	case PhaseReduce:
+		return "reduce"
+	case PhasePut:
+		return "put"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// JobError is returned by Run when a job fails. Input is set for the map
+// phase (the input that failed to be mapped) and for the put phase (the
+// reducer output that failed to be read). Partition, the index of the
+// reducer, and Keys, its keyset, are set for the reduce phase; Keys is empty
+// for partitioned shuffles, where the driver does not know the keys.
+type JobError struct {
+	Phase     Phase
+	Input     *Resource
+	Partition int
+	Keys      []string
+	Err       error
+}
+
+func (e *JobError) Error() string {
+	switch {
+	case e.Input != nil:
+		return fmt.Sprintf("%s phase failed for `%s`: %v", e.Phase, e.Input.Locator, e.Err)
+	case e.Phase == PhaseReduce && e.Keys != nil:
+		return fmt.Sprintf("%s phase failed for partition %d with keyset %s: %v", e.Phase, e.Partition, describeKeyset(e.Keys), e.Err)
+	case e.Phase == PhaseReduce:
+		return fmt.Sprintf("%s phase failed for partition %d: %v", e.Phase, e.Partition, e.Err)
+	}
+	return fmt.Sprintf("%s phase failed: %v", e.Phase, e.Err)
+}
+
+// Unwrap allows errors.Is and errors.As to see through JobError.
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// Cause allows errors.Cause to see through JobError.
+func (e *JobError) Cause() error {
+	return e.Err
+}
+
+// describeKeyset returns a short human-readable description of a keyset,
+// without listing all of its (possibly millions of) keys.
+func describeKeyset(keys []string) string {
+	switch len(keys) {
+	case 0:
+		return "[]"
+	case 1:
+		return fmt.Sprintf("[%q]", keys[0])
+	case 2:
+		return fmt.Sprintf("[%q %q]", keys[0], keys[1])
+	}
+	return fmt.Sprintf("[%q ... %q] (%d keys)", keys[0], keys[len(keys)-1], len(keys))
+}
@@ -26,6 +26,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/ease-lab/mare"
@@ -41,20 +42,34 @@ func (c *counter) Map(_ context.Context, pair mare.Pair) (outputs []mare.Pair, e
 		if len(word) == 0 {
 			continue
 		}
-		outputs = append(outputs, mare.Pair{Key: word, Value: ""})
+		outputs = append(outputs, mare.Pair{Key: word, Value: "1"})
 	}
 	return
 }
 
 func (c *counter) Reduce(_ context.Context, key string, values []string) ([]mare.Pair, error) {
-	output := mare.Pair{Key: key, Value: strconv.Itoa(len(values))}
+	count := 0
+	for _, value := range values {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Errorf("Invalid count: %s", value)
+		}
+		count += n
+	}
+	output := mare.Pair{Key: key, Value: strconv.Itoa(count)}
 	return []mare.Pair{output}, nil
 }
 
+// Combine pre-aggregates the counts of a mapper, so that every mapper uploads
+// a single pair per unique word.
+func (c *counter) Combine(ctx context.Context, key string, values []string) ([]mare.Pair, error) {
+	return c.Reduce(ctx, key, values)
+}
+
 func main() {
 	logrus.SetLevel(logrus.DebugLevel)
 	counter := new(counter)
-	if err := mare.Work(counter, counter); err != nil {
+	if err := mare.Work(counter, counter, mare.WorkCombiner(counter)); err != nil {
 		logrus.Fatal("Failed to work: ", err)
 	}
 }
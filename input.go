@@ -0,0 +1,172 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Input locators may be patterns, which the driver expands into the inputs
+// they match before the job starts:
+//
+//  - FILE locators may be glob patterns as understood by filepath.Glob, e.g.
+//    `inputs/*.tsv`, or directories, which stand for every file in them.
+//  - S3 locators may be glob patterns as understood by path.Match, e.g.
+//    `s3://bucket/data/*.tsv`, or prefixes ending with a slash, e.g.
+//    `s3://bucket/data/`, which stand for every object directly under them.
+//
+// As with filepath.Glob, `*` does not match slashes. Inputs that a pattern
+// expands into are further filtered by WithInputFilter; inputs listed
+// explicitly are always kept.
+
+// inputFilter selects inputs by matching their base names against glob
+// patterns.
+type inputFilter struct {
+	include []string
+	exclude []string
+}
+
+func (f *inputFilter) validate() error {
+	for _, patterns := range [][]string{f.include, f.exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.Wrapf(err, "invalid input filter `%s`", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether `name` matches at least one include pattern, if
+// there are any, and no exclude pattern.
+func (f *inputFilter) matches(name string) bool {
+	for _, pattern := range f.exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// expandInputs expands the patterns among `locators` into the locators of
+// the inputs they match, in lexical order. It fails if a pattern matches no
+// input at all.
+func expandInputs(ctx context.Context, backend ResourceBackend, locators []string, filter *inputFilter) ([]string, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	var expanded []string
+	for _, locator := range locators {
+		var matches []string
+		var isPattern bool
+		var err error
+		switch backend {
+		case ResourceBackend_FILE:
+			matches, isPattern, err = expandFilePattern(locator)
+		case ResourceBackend_S3:
+			matches, isPattern, err = expandS3Pattern(ctx, locator)
+		default:
+			expanded = append(expanded, locator)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to expand input `%s`", locator)
+		}
+		if !isPattern {
+			expanded = append(expanded, locator)
+			continue
+		}
+
+		nMatches := 0
+		for _, match := range matches {
+			if filter.matches(path.Base(filepath.ToSlash(match))) {
+				expanded = append(expanded, match)
+				nMatches++
+			}
+		}
+		if nMatches == 0 {
+			return nil, fmt.Errorf("no inputs match `%s`", locator)
+		}
+	}
+	return expanded, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[`)
+}
+
+// expandFilePattern returns the regular files matched by `locator`, if it is
+// a glob pattern or a directory.
+func expandFilePattern(locator string) (files []string, isPattern bool, err error) {
+	pattern := locator
+	if !hasGlobMeta(locator) {
+		info, err := os.Stat(locator)
+		if err != nil || !info.IsDir() {
+			// Leave it to the mapper to fail on missing files.
+			return nil, false, nil
+		}
+		pattern = filepath.Join(locator, "*")
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, true, err
+	}
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, true, err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, match)
+		}
+	}
+	return files, true, nil
+}
+
+// expandS3Pattern returns the objects matched by `locator`, if it is a glob
+// pattern or a prefix.
+func expandS3Pattern(ctx context.Context, locator string) (objects []string, isPattern bool, err error) {
+	pattern := locator
+	if strings.HasSuffix(locator, "/") {
+		pattern += "*"
+	} else if !hasGlobMeta(locator) {
+		return nil, false, nil
+	}
+	objects, err = listS3Resources(ctx, pattern)
+	return objects, true, err
+}
@@ -36,3 +36,16 @@ type Mapper interface {
 type Reducer interface {
 	Reduce(ctx context.Context, key string, values []string) ([]Pair, error)
 }
+
+// Combiner pre-aggregates the output pairs of a single MapBatch, per key,
+// before they are uploaded. Its output is fed to the reducer, so it must not
+// change the result of reducing it.
+type Combiner interface {
+	Combine(ctx context.Context, key string, values []string) ([]Pair, error)
+}
+
+// Partitioner assigns a key to one of `n` partitions, i.e. reducers. It must
+// return a value in [0, n) and be deterministic across processes.
+type Partitioner interface {
+	Partition(key string, n int) int
+}
@@ -108,6 +108,19 @@ type Resource struct {
 
 	Backend ResourceBackend `protobuf:"varint,1,opt,name=backend,proto3,enum=mare.ResourceBackend" json:"backend,omitempty"`
 	Locator string          `protobuf:"bytes,2,opt,name=locator,proto3" json:"locator,omitempty"`
+	// Name of the codec the pairs in the resource are encoded with; empty
+	// for TSV.
+	Codec string `protobuf:"bytes,3,opt,name=codec,proto3" json:"codec,omitempty"`
+	// If length is non-zero, the resource is only the split of the object at
+	// locator made of the lines that start within [offset, offset+length).
+	// See WithSplitSize.
+	Offset int64 `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length int64 `protobuf:"varint,5,opt,name=length,proto3" json:"length,omitempty"`
+	// Compression the resource is compressed with, as set by
+	// ResourceHint.Create: either one of "gzip", "zstd", "snappy", or "none".
+	// If empty, e.g. for inputs, the compression is detected when the
+	// resource is read.
+	Compression string `protobuf:"bytes,6,opt,name=compression,proto3" json:"compression,omitempty"`
 }
 
 func (x *Resource) Reset() {
@@ -156,6 +169,34 @@ func (x *Resource) GetLocator() string {
 	return ""
 }
 
+func (x *Resource) GetCodec() string {
+	if x != nil {
+		return x.Codec
+	}
+	return ""
+}
+
+func (x *Resource) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *Resource) GetLength() int64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *Resource) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
 type ResourceHint struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -163,6 +204,13 @@ type ResourceHint struct {
 
 	Backend ResourceBackend `protobuf:"varint,1,opt,name=backend,proto3,enum=mare.ResourceBackend" json:"backend,omitempty"`
 	Hint    string          `protobuf:"bytes,2,opt,name=hint,proto3" json:"hint,omitempty"`
+	// Name of the codec to encode the pairs in the resource with; empty for
+	// TSV.
+	Codec string `protobuf:"bytes,3,opt,name=codec,proto3" json:"codec,omitempty"`
+	// Compression to apply to the resource: either one of "gzip", "zstd",
+	// or "snappy"; empty for none. Compressed resources are detected and
+	// decompressed automatically when they are read.
+	Compression string `protobuf:"bytes,4,opt,name=compression,proto3" json:"compression,omitempty"`
 }
 
 func (x *ResourceHint) Reset() {
@@ -211,6 +259,20 @@ func (x *ResourceHint) GetHint() string {
 	return ""
 }
 
+func (x *ResourceHint) GetCodec() string {
+	if x != nil {
+		return x.Codec
+	}
+	return ""
+}
+
+func (x *ResourceHint) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
 type MapBatchRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -218,6 +280,20 @@ type MapBatchRequest struct {
 
 	Input      *Resource     `protobuf:"bytes,1,opt,name=input,proto3" json:"input,omitempty"`
 	OutputHint *ResourceHint `protobuf:"bytes,2,opt,name=outputHint,proto3" json:"outputHint,omitempty"`
+	// If non-zero, the output is partitioned into nPartitions resources, one
+	// per reducer, instead of being returned as a single resource along with
+	// its keys.
+	NPartitions int32 `protobuf:"varint,3,opt,name=nPartitions,proto3" json:"nPartitions,omitempty"`
+	// If non-empty and nPartitions is non-zero, the output is range
+	// partitioned by these sorted split points instead of by the partitioner
+	// of the worker.
+	SplitPoints []string `protobuf:"bytes,4,rep,name=splitPoints,proto3" json:"splitPoints,omitempty"`
+	// If non-zero, the request is a sampling pre-pass: no output is written,
+	// and keys holds a uniform sample of at most sampleSize keys of the output
+	// pairs.
+	SampleSize int32 `protobuf:"varint,5,opt,name=sampleSize,proto3" json:"sampleSize,omitempty"`
+	// If non-zero, at most sampleRecords input pairs are mapped when sampling.
+	SampleRecords int32 `protobuf:"varint,6,opt,name=sampleRecords,proto3" json:"sampleRecords,omitempty"`
 }
 
 func (x *MapBatchRequest) Reset() {
@@ -266,6 +342,34 @@ func (x *MapBatchRequest) GetOutputHint() *ResourceHint {
 	return nil
 }
 
+func (x *MapBatchRequest) GetNPartitions() int32 {
+	if x != nil {
+		return x.NPartitions
+	}
+	return 0
+}
+
+func (x *MapBatchRequest) GetSplitPoints() []string {
+	if x != nil {
+		return x.SplitPoints
+	}
+	return nil
+}
+
+func (x *MapBatchRequest) GetSampleSize() int32 {
+	if x != nil {
+		return x.SampleSize
+	}
+	return 0
+}
+
+func (x *MapBatchRequest) GetSampleRecords() int32 {
+	if x != nil {
+		return x.SampleRecords
+	}
+	return 0
+}
+
 type MapBatchResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -273,6 +377,10 @@ type MapBatchResponse struct {
 
 	Output *Resource `protobuf:"bytes,1,opt,name=output,proto3" json:"output,omitempty"`
 	Keys   []string  `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	// Set instead of output and keys if nPartitions was non-zero. Empty
+	// partitions have the NULL backend.
+	Partitions []*Resource      `protobuf:"bytes,3,rep,name=partitions,proto3" json:"partitions,omitempty"`
+	Counters   map[string]int64 `protobuf:"bytes,4,rep,name=counters,proto3" json:"counters,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
 }
 
 func (x *MapBatchResponse) Reset() {
@@ -321,6 +429,20 @@ func (x *MapBatchResponse) GetKeys() []string {
 	return nil
 }
 
+func (x *MapBatchResponse) GetPartitions() []*Resource {
+	if x != nil {
+		return x.Partitions
+	}
+	return nil
+}
+
+func (x *MapBatchResponse) GetCounters() map[string]int64 {
+	if x != nil {
+		return x.Counters
+	}
+	return nil
+}
+
 type ReduceBatchRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -329,6 +451,8 @@ type ReduceBatchRequest struct {
 	Keys       []string      `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
 	Inputs     []*Resource   `protobuf:"bytes,2,rep,name=inputs,proto3" json:"inputs,omitempty"`
 	OutputHint *ResourceHint `protobuf:"bytes,3,opt,name=outputHint,proto3" json:"outputHint,omitempty"`
+	// If true, keys is ignored and every key found in inputs is reduced.
+	AllKeys bool `protobuf:"varint,4,opt,name=allKeys,proto3" json:"allKeys,omitempty"`
 }
 
 func (x *ReduceBatchRequest) Reset() {
@@ -384,6 +508,13 @@ func (x *ReduceBatchRequest) GetOutputHint() *ResourceHint {
 	return nil
 }
 
+func (x *ReduceBatchRequest) GetAllKeys() bool {
+	if x != nil {
+		return x.AllKeys
+	}
+	return false
+}
+
 type ReduceBatchResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -431,57 +562,399 @@ func (x *ReduceBatchResponse) GetOutput() *Resource {
 	return nil
 }
 
+type CapabilitiesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *CapabilitiesRequest) Reset() {
+	*x = CapabilitiesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mare_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CapabilitiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapabilitiesRequest) ProtoMessage() {}
+
+func (x *CapabilitiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mare_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapabilitiesRequest.ProtoReflect.Descriptor instead.
+func (*CapabilitiesRequest) Descriptor() ([]byte, []int) {
+	return file_mare_proto_rawDescGZIP(), []int{6}
+}
+
+type CapabilitiesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Map    bool `protobuf:"varint,1,opt,name=map,proto3" json:"map,omitempty"`
+	Reduce bool `protobuf:"varint,2,opt,name=reduce,proto3" json:"reduce,omitempty"`
+	// Whether the worker partitions map outputs with a partitioner other
+	// than the default one; see WorkPartitioner.
+	CustomPartitioner bool `protobuf:"varint,3,opt,name=customPartitioner,proto3" json:"customPartitioner,omitempty"`
+}
+
+func (x *CapabilitiesResponse) Reset() {
+	*x = CapabilitiesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mare_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CapabilitiesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapabilitiesResponse) ProtoMessage() {}
+
+func (x *CapabilitiesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mare_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapabilitiesResponse.ProtoReflect.Descriptor instead.
+func (*CapabilitiesResponse) Descriptor() ([]byte, []int) {
+	return file_mare_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CapabilitiesResponse) GetMap() bool {
+	if x != nil {
+		return x.Map
+	}
+	return false
+}
+
+func (x *CapabilitiesResponse) GetReduce() bool {
+	if x != nil {
+		return x.Reduce
+	}
+	return false
+}
+
+func (x *CapabilitiesResponse) GetCustomPartitioner() bool {
+	if x != nil {
+		return x.CustomPartitioner
+	}
+	return false
+}
+
+type XdtFetchRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *XdtFetchRequest) Reset() {
+	*x = XdtFetchRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mare_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *XdtFetchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*XdtFetchRequest) ProtoMessage() {}
+
+func (x *XdtFetchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mare_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use XdtFetchRequest.ProtoReflect.Descriptor instead.
+func (*XdtFetchRequest) Descriptor() ([]byte, []int) {
+	return file_mare_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *XdtFetchRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type XdtChunk struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *XdtChunk) Reset() {
+	*x = XdtChunk{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mare_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *XdtChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*XdtChunk) ProtoMessage() {}
+
+func (x *XdtChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_mare_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use XdtChunk.ProtoReflect.Descriptor instead.
+func (*XdtChunk) Descriptor() ([]byte, []int) {
+	return file_mare_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *XdtChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type XdtReleaseRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *XdtReleaseRequest) Reset() {
+	*x = XdtReleaseRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mare_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *XdtReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*XdtReleaseRequest) ProtoMessage() {}
+
+func (x *XdtReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mare_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use XdtReleaseRequest.ProtoReflect.Descriptor instead.
+func (*XdtReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_mare_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *XdtReleaseRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type XdtReleaseResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *XdtReleaseResponse) Reset() {
+	*x = XdtReleaseResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mare_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *XdtReleaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*XdtReleaseResponse) ProtoMessage() {}
+
+func (x *XdtReleaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_mare_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use XdtReleaseResponse.ProtoReflect.Descriptor instead.
+func (*XdtReleaseResponse) Descriptor() ([]byte, []int) {
+	return file_mare_proto_rawDescGZIP(), []int{11}
+}
+
 var File_mare_proto protoreflect.FileDescriptor
 
 var file_mare_proto_rawDesc = []byte{
 	0x0a, 0x0a, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x04, 0x6d, 0x61,
-	0x72, 0x65, 0x22, 0x55, 0x0a, 0x08, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x2f,
-	0x0a, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32,
-	0x15, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x42,
-	0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x52, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12,
-	0x18, 0x0a, 0x07, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x07, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x6f, 0x72, 0x22, 0x53, 0x0a, 0x0c, 0x52, 0x65, 0x73,
-	0x6f, 0x75, 0x72, 0x63, 0x65, 0x48, 0x69, 0x6e, 0x74, 0x12, 0x2f, 0x0a, 0x07, 0x62, 0x61, 0x63,
-	0x6b, 0x65, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x6d, 0x61, 0x72,
-	0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e,
-	0x64, 0x52, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x69,
-	0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x69, 0x6e, 0x74, 0x22, 0x6b,
-	0x0a, 0x0f, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x12, 0x24, 0x0a, 0x05, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x72, 0x65, 0x22, 0xbd, 0x01, 0x0a, 0x08, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12,
+	0x2f, 0x0a, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x15, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x52, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64,
+	0x12, 0x18, 0x0a, 0x07, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x6f, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f,
+	0x64, 0x65, 0x63, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63, 0x6f, 0x64, 0x65, 0x63,
+	0x12, 0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67,
+	0x74, 0x68, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68,
+	0x12, 0x20, 0x0a, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69,
+	0x6f, 0x6e, 0x22, 0x8b, 0x01, 0x0a, 0x0c, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x48,
+	0x69, 0x6e, 0x74, 0x12, 0x2f, 0x0a, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f,
+	0x75, 0x72, 0x63, 0x65, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x52, 0x07, 0x62, 0x61, 0x63,
+	0x6b, 0x65, 0x6e, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x69, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x68, 0x69, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x64, 0x65,
+	0x63, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63, 0x6f, 0x64, 0x65, 0x63, 0x12, 0x20,
+	0x0a, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e,
+	0x22, 0xf5, 0x01, 0x0a, 0x0f, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x24, 0x0a, 0x05, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x52, 0x05, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x12, 0x32, 0x0a, 0x0a, 0x6f, 0x75,
+	0x74, 0x70, 0x75, 0x74, 0x48, 0x69, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12,
+	0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x48, 0x69,
+	0x6e, 0x74, 0x52, 0x0a, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x48, 0x69, 0x6e, 0x74, 0x12, 0x20,
+	0x0a, 0x0b, 0x6e, 0x50, 0x61, 0x72, 0x74, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x0b, 0x6e, 0x50, 0x61, 0x72, 0x74, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x12, 0x20, 0x0a, 0x0b, 0x73, 0x70, 0x6c, 0x69, 0x74, 0x50, 0x6f, 0x69, 0x6e, 0x74, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b, 0x73, 0x70, 0x6c, 0x69, 0x74, 0x50, 0x6f, 0x69, 0x6e,
+	0x74, 0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x53, 0x69, 0x7a, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x53, 0x69,
+	0x7a, 0x65, 0x12, 0x24, 0x0a, 0x0d, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x52, 0x65, 0x63, 0x6f,
+	0x72, 0x64, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0d, 0x73, 0x61, 0x6d, 0x70, 0x6c,
+	0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x22, 0xfd, 0x01, 0x0a, 0x10, 0x4d, 0x61, 0x70,
+	0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x26, 0x0a,
+	0x06, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e,
+	0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x06, 0x6f,
+	0x75, 0x74, 0x70, 0x75, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x12, 0x2e, 0x0a, 0x0a, 0x70, 0x61, 0x72,
+	0x74, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e,
+	0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x0a, 0x70,
+	0x61, 0x72, 0x74, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x40, 0x0a, 0x08, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x65, 0x72, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x6d, 0x61,
+	0x72, 0x65, 0x2e, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x2e, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x52, 0x08, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x1a, 0x3b, 0x0a, 0x0d, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03,
+	0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14,
+	0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x9e, 0x01, 0x0a, 0x12, 0x52, 0x65, 0x64,
+	0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x6b,
+	0x65, 0x79, 0x73, 0x12, 0x26, 0x0a, 0x06, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x52, 0x06, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x73, 0x12, 0x32, 0x0a, 0x0a, 0x6f,
+	0x75, 0x74, 0x70, 0x75, 0x74, 0x48, 0x69, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x12, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x48,
+	0x69, 0x6e, 0x74, 0x52, 0x0a, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x48, 0x69, 0x6e, 0x74, 0x12,
+	0x18, 0x0a, 0x07, 0x61, 0x6c, 0x6c, 0x4b, 0x65, 0x79, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x07, 0x61, 0x6c, 0x6c, 0x4b, 0x65, 0x79, 0x73, 0x22, 0x3d, 0x0a, 0x13, 0x52, 0x65, 0x64,
+	0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x26, 0x0a, 0x06, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
 	0x32, 0x0e, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
-	0x52, 0x05, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x12, 0x32, 0x0a, 0x0a, 0x6f, 0x75, 0x74, 0x70, 0x75,
-	0x74, 0x48, 0x69, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6d, 0x61,
-	0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x48, 0x69, 0x6e, 0x74, 0x52,
-	0x0a, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x48, 0x69, 0x6e, 0x74, 0x22, 0x4e, 0x0a, 0x10, 0x4d,
-	0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
-	0x26, 0x0a, 0x06, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x0e, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52,
-	0x06, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x18,
-	0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x22, 0x84, 0x01, 0x0a, 0x12,
-	0x52, 0x65, 0x64, 0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09,
-	0x52, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x12, 0x26, 0x0a, 0x06, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x73,
-	0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65,
-	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x06, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x73, 0x12, 0x32,
-	0x0a, 0x0a, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x48, 0x69, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72,
-	0x63, 0x65, 0x48, 0x69, 0x6e, 0x74, 0x52, 0x0a, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x48, 0x69,
-	0x6e, 0x74, 0x22, 0x3d, 0x0a, 0x13, 0x52, 0x65, 0x64, 0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63,
-	0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x26, 0x0a, 0x06, 0x6f, 0x75, 0x74,
-	0x70, 0x75, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x6d, 0x61, 0x72, 0x65,
-	0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x06, 0x6f, 0x75, 0x74, 0x70, 0x75,
-	0x74, 0x2a, 0x36, 0x0a, 0x0f, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x42, 0x61, 0x63,
-	0x6b, 0x65, 0x6e, 0x64, 0x12, 0x08, 0x0a, 0x04, 0x4e, 0x55, 0x4c, 0x4c, 0x10, 0x00, 0x12, 0x08,
-	0x0a, 0x04, 0x46, 0x49, 0x4c, 0x45, 0x10, 0x01, 0x12, 0x06, 0x0a, 0x02, 0x53, 0x33, 0x10, 0x02,
-	0x12, 0x07, 0x0a, 0x03, 0x58, 0x44, 0x54, 0x10, 0x03, 0x32, 0x89, 0x01, 0x0a, 0x04, 0x4d, 0x61,
-	0x72, 0x65, 0x12, 0x3b, 0x0a, 0x08, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x15,
-	0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x4d, 0x61, 0x70,
-	0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12,
-	0x44, 0x0a, 0x0b, 0x52, 0x65, 0x64, 0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x18,
-	0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x64, 0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63,
-	0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e,
-	0x52, 0x65, 0x64, 0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x52, 0x06, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x22, 0x15, 0x0a, 0x13, 0x43, 0x61, 0x70, 0x61,
+	0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22,
+	0x6e, 0x0a, 0x14, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x61, 0x70, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x03, 0x6d, 0x61, 0x70, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x64,
+	0x75, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x72, 0x65, 0x64, 0x75, 0x63,
+	0x65, 0x12, 0x2c, 0x0a, 0x11, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x50, 0x61, 0x72, 0x74, 0x69,
+	0x74, 0x69, 0x6f, 0x6e, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x11, 0x63, 0x75,
+	0x73, 0x74, 0x6f, 0x6d, 0x50, 0x61, 0x72, 0x74, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x65, 0x72, 0x22,
+	0x21, 0x0a, 0x0f, 0x58, 0x64, 0x74, 0x46, 0x65, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
+	0x69, 0x64, 0x22, 0x1e, 0x0a, 0x08, 0x58, 0x64, 0x74, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x12,
+	0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61,
+	0x74, 0x61, 0x22, 0x23, 0x0a, 0x11, 0x58, 0x64, 0x74, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x14, 0x0a, 0x12, 0x58, 0x64, 0x74, 0x52, 0x65,
+	0x6c, 0x65, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x2a, 0x36, 0x0a,
+	0x0f, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64,
+	0x12, 0x08, 0x0a, 0x04, 0x4e, 0x55, 0x4c, 0x4c, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x46, 0x49,
+	0x4c, 0x45, 0x10, 0x01, 0x12, 0x06, 0x0a, 0x02, 0x53, 0x33, 0x10, 0x02, 0x12, 0x07, 0x0a, 0x03,
+	0x58, 0x44, 0x54, 0x10, 0x03, 0x32, 0xd2, 0x01, 0x0a, 0x04, 0x4d, 0x61, 0x72, 0x65, 0x12, 0x3b,
+	0x0a, 0x08, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x15, 0x2e, 0x6d, 0x61, 0x72,
+	0x65, 0x2e, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x16, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x4d, 0x61, 0x70, 0x42, 0x61, 0x74, 0x63,
+	0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x44, 0x0a, 0x0b, 0x52,
+	0x65, 0x64, 0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x18, 0x2e, 0x6d, 0x61, 0x72,
+	0x65, 0x2e, 0x52, 0x65, 0x64, 0x75, 0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x52, 0x65, 0x64, 0x75,
+	0x63, 0x65, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22,
+	0x00, 0x12, 0x47, 0x0a, 0x0c, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65,
+	0x73, 0x12, 0x19, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c,
+	0x69, 0x74, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x6d,
+	0x61, 0x72, 0x65, 0x2e, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x32, 0x79, 0x0a, 0x03, 0x58, 0x64,
+	0x74, 0x12, 0x32, 0x0a, 0x05, 0x46, 0x65, 0x74, 0x63, 0x68, 0x12, 0x15, 0x2e, 0x6d, 0x61, 0x72,
+	0x65, 0x2e, 0x58, 0x64, 0x74, 0x46, 0x65, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x0e, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x58, 0x64, 0x74, 0x43, 0x68, 0x75, 0x6e,
+	0x6b, 0x22, 0x00, 0x30, 0x01, 0x12, 0x3e, 0x0a, 0x07, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65,
+	0x12, 0x17, 0x2e, 0x6d, 0x61, 0x72, 0x65, 0x2e, 0x58, 0x64, 0x74, 0x52, 0x65, 0x6c, 0x65, 0x61,
+	0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6d, 0x61, 0x72, 0x65,
+	0x2e, 0x58, 0x64, 0x74, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
 	0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x1a, 0x5a, 0x18, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
 	0x63, 0x6f, 0x6d, 0x2f, 0x65, 0x61, 0x73, 0x65, 0x2d, 0x6c, 0x61, 0x62, 0x2f, 0x6d, 0x61, 0x72,
 	0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
@@ -500,15 +973,22 @@ func file_mare_proto_rawDescGZIP() []byte {
 }
 
 var file_mare_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_mare_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_mare_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_mare_proto_goTypes = []interface{}{
-	(ResourceBackend)(0),        // 0: mare.ResourceBackend
-	(*Resource)(nil),            // 1: mare.Resource
-	(*ResourceHint)(nil),        // 2: mare.ResourceHint
-	(*MapBatchRequest)(nil),     // 3: mare.MapBatchRequest
-	(*MapBatchResponse)(nil),    // 4: mare.MapBatchResponse
-	(*ReduceBatchRequest)(nil),  // 5: mare.ReduceBatchRequest
-	(*ReduceBatchResponse)(nil), // 6: mare.ReduceBatchResponse
+	(ResourceBackend)(0),         // 0: mare.ResourceBackend
+	(*Resource)(nil),             // 1: mare.Resource
+	(*ResourceHint)(nil),         // 2: mare.ResourceHint
+	(*MapBatchRequest)(nil),      // 3: mare.MapBatchRequest
+	(*MapBatchResponse)(nil),     // 4: mare.MapBatchResponse
+	(*ReduceBatchRequest)(nil),   // 5: mare.ReduceBatchRequest
+	(*ReduceBatchResponse)(nil),  // 6: mare.ReduceBatchResponse
+	(*CapabilitiesRequest)(nil),  // 7: mare.CapabilitiesRequest
+	(*CapabilitiesResponse)(nil), // 8: mare.CapabilitiesResponse
+	(*XdtFetchRequest)(nil),      // 9: mare.XdtFetchRequest
+	(*XdtChunk)(nil),             // 10: mare.XdtChunk
+	(*XdtReleaseRequest)(nil),    // 11: mare.XdtReleaseRequest
+	(*XdtReleaseResponse)(nil),   // 12: mare.XdtReleaseResponse
+	nil,                          // 13: mare.MapBatchResponse.CountersEntry
 }
 var file_mare_proto_depIdxs = []int32{
 	0,  // 0: mare.Resource.backend:type_name -> mare.ResourceBackend
@@ -516,18 +996,26 @@ var file_mare_proto_depIdxs = []int32{
 	1,  // 2: mare.MapBatchRequest.input:type_name -> mare.Resource
 	2,  // 3: mare.MapBatchRequest.outputHint:type_name -> mare.ResourceHint
 	1,  // 4: mare.MapBatchResponse.output:type_name -> mare.Resource
-	1,  // 5: mare.ReduceBatchRequest.inputs:type_name -> mare.Resource
-	2,  // 6: mare.ReduceBatchRequest.outputHint:type_name -> mare.ResourceHint
-	1,  // 7: mare.ReduceBatchResponse.output:type_name -> mare.Resource
-	3,  // 8: mare.Mare.MapBatch:input_type -> mare.MapBatchRequest
-	5,  // 9: mare.Mare.ReduceBatch:input_type -> mare.ReduceBatchRequest
-	4,  // 10: mare.Mare.MapBatch:output_type -> mare.MapBatchResponse
-	6,  // 11: mare.Mare.ReduceBatch:output_type -> mare.ReduceBatchResponse
-	10, // [10:12] is the sub-list for method output_type
-	8,  // [8:10] is the sub-list for method input_type
-	8,  // [8:8] is the sub-list for extension type_name
-	8,  // [8:8] is the sub-list for extension extendee
-	0,  // [0:8] is the sub-list for field type_name
+	1,  // 5: mare.MapBatchResponse.partitions:type_name -> mare.Resource
+	13, // 6: mare.MapBatchResponse.counters:type_name -> mare.MapBatchResponse.CountersEntry
+	1,  // 7: mare.ReduceBatchRequest.inputs:type_name -> mare.Resource
+	2,  // 8: mare.ReduceBatchRequest.outputHint:type_name -> mare.ResourceHint
+	1,  // 9: mare.ReduceBatchResponse.output:type_name -> mare.Resource
+	3,  // 10: mare.Mare.MapBatch:input_type -> mare.MapBatchRequest
+	5,  // 11: mare.Mare.ReduceBatch:input_type -> mare.ReduceBatchRequest
+	7,  // 12: mare.Mare.Capabilities:input_type -> mare.CapabilitiesRequest
+	9,  // 13: mare.Xdt.Fetch:input_type -> mare.XdtFetchRequest
+	11, // 14: mare.Xdt.Release:input_type -> mare.XdtReleaseRequest
+	4,  // 15: mare.Mare.MapBatch:output_type -> mare.MapBatchResponse
+	6,  // 16: mare.Mare.ReduceBatch:output_type -> mare.ReduceBatchResponse
+	8,  // 17: mare.Mare.Capabilities:output_type -> mare.CapabilitiesResponse
+	10, // 18: mare.Xdt.Fetch:output_type -> mare.XdtChunk
+	12, // 19: mare.Xdt.Release:output_type -> mare.XdtReleaseResponse
+	15, // [15:20] is the sub-list for method output_type
+	10, // [10:15] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_mare_proto_init() }
@@ -608,6 +1096,78 @@ func file_mare_proto_init() {
 				return nil
 			}
 		}
+		file_mare_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CapabilitiesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mare_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CapabilitiesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mare_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*XdtFetchRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mare_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*XdtChunk); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mare_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*XdtReleaseRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mare_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*XdtReleaseResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -615,9 +1175,9 @@ func file_mare_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_mare_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   6,
+			NumMessages:   13,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_mare_proto_goTypes,
 		DependencyIndexes: file_mare_proto_depIdxs,
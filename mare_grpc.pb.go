@@ -19,6 +19,8 @@ const _ = grpc.SupportPackageIsVersion7
 type MareClient interface {
 	MapBatch(ctx context.Context, in *MapBatchRequest, opts ...grpc.CallOption) (*MapBatchResponse, error)
 	ReduceBatch(ctx context.Context, in *ReduceBatchRequest, opts ...grpc.CallOption) (*ReduceBatchResponse, error)
+	// Capabilities reports which of the above the worker serves.
+	Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesResponse, error)
 }
 
 type mareClient struct {
@@ -47,12 +49,23 @@ func (c *mareClient) ReduceBatch(ctx context.Context, in *ReduceBatchRequest, op
 	return out, nil
 }
 
+func (c *mareClient) Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesResponse, error) {
+	out := new(CapabilitiesResponse)
+	err := c.cc.Invoke(ctx, "/mare.Mare/Capabilities", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MareServer is the server API for Mare service.
 // All implementations must embed UnimplementedMareServer
 // for forward compatibility
 type MareServer interface {
 	MapBatch(context.Context, *MapBatchRequest) (*MapBatchResponse, error)
 	ReduceBatch(context.Context, *ReduceBatchRequest) (*ReduceBatchResponse, error)
+	// Capabilities reports which of the above the worker serves.
+	Capabilities(context.Context, *CapabilitiesRequest) (*CapabilitiesResponse, error)
 	mustEmbedUnimplementedMareServer()
 }
 
@@ -66,6 +79,9 @@ func (UnimplementedMareServer) MapBatch(context.Context, *MapBatchRequest) (*Map
 func (UnimplementedMareServer) ReduceBatch(context.Context, *ReduceBatchRequest) (*ReduceBatchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ReduceBatch not implemented")
 }
+func (UnimplementedMareServer) Capabilities(context.Context, *CapabilitiesRequest) (*CapabilitiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Capabilities not implemented")
+}
 func (UnimplementedMareServer) mustEmbedUnimplementedMareServer() {}
 
 // UnsafeMareServer may be embedded to opt out of forward compatibility for this service.
@@ -115,6 +131,24 @@ func _Mare_ReduceBatch_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Mare_Capabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MareServer).Capabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mare.Mare/Capabilities",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MareServer).Capabilities(ctx, req.(*CapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Mare_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "mare.Mare",
 	HandlerType: (*MareServer)(nil),
@@ -127,7 +161,158 @@ var _Mare_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ReduceBatch",
 			Handler:    _Mare_ReduceBatch_Handler,
 		},
+		{
+			MethodName: "Capabilities",
+			Handler:    _Mare_Capabilities_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "mare.proto",
 }
+
+// XdtClient is the client API for Xdt service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type XdtClient interface {
+	Fetch(ctx context.Context, in *XdtFetchRequest, opts ...grpc.CallOption) (Xdt_FetchClient, error)
+	Release(ctx context.Context, in *XdtReleaseRequest, opts ...grpc.CallOption) (*XdtReleaseResponse, error)
+}
+
+type xdtClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewXdtClient(cc grpc.ClientConnInterface) XdtClient {
+	return &xdtClient{cc}
+}
+
+func (c *xdtClient) Fetch(ctx context.Context, in *XdtFetchRequest, opts ...grpc.CallOption) (Xdt_FetchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Xdt_serviceDesc.Streams[0], "/mare.Xdt/Fetch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &xdtFetchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Xdt_FetchClient interface {
+	Recv() (*XdtChunk, error)
+	grpc.ClientStream
+}
+
+type xdtFetchClient struct {
+	grpc.ClientStream
+}
+
+func (x *xdtFetchClient) Recv() (*XdtChunk, error) {
+	m := new(XdtChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *xdtClient) Release(ctx context.Context, in *XdtReleaseRequest, opts ...grpc.CallOption) (*XdtReleaseResponse, error) {
+	out := new(XdtReleaseResponse)
+	err := c.cc.Invoke(ctx, "/mare.Xdt/Release", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// XdtServer is the server API for Xdt service.
+// All implementations must embed UnimplementedXdtServer
+// for forward compatibility
+type XdtServer interface {
+	Fetch(*XdtFetchRequest, Xdt_FetchServer) error
+	Release(context.Context, *XdtReleaseRequest) (*XdtReleaseResponse, error)
+	mustEmbedUnimplementedXdtServer()
+}
+
+// UnimplementedXdtServer must be embedded to have forward compatible implementations.
+type UnimplementedXdtServer struct {
+}
+
+func (UnimplementedXdtServer) Fetch(*XdtFetchRequest, Xdt_FetchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Fetch not implemented")
+}
+func (UnimplementedXdtServer) Release(context.Context, *XdtReleaseRequest) (*XdtReleaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Release not implemented")
+}
+func (UnimplementedXdtServer) mustEmbedUnimplementedXdtServer() {}
+
+// UnsafeXdtServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to XdtServer will
+// result in compilation errors.
+type UnsafeXdtServer interface {
+	mustEmbedUnimplementedXdtServer()
+}
+
+func RegisterXdtServer(s grpc.ServiceRegistrar, srv XdtServer) {
+	s.RegisterService(&_Xdt_serviceDesc, srv)
+}
+
+func _Xdt_Fetch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(XdtFetchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(XdtServer).Fetch(m, &xdtFetchServer{stream})
+}
+
+type Xdt_FetchServer interface {
+	Send(*XdtChunk) error
+	grpc.ServerStream
+}
+
+type xdtFetchServer struct {
+	grpc.ServerStream
+}
+
+func (x *xdtFetchServer) Send(m *XdtChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Xdt_Release_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(XdtReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(XdtServer).Release(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mare.Xdt/Release",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(XdtServer).Release(ctx, req.(*XdtReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Xdt_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "mare.Xdt",
+	HandlerType: (*XdtServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Release",
+			Handler:    _Xdt_Release_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Fetch",
+			Handler:       _Xdt_Fetch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mare.proto",
+}
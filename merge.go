@@ -0,0 +1,148 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"container/heap"
+	"io"
+)
+
+// pairCursor reads a sequence of pairs sorted by key one pair at a time.
+type pairCursor struct {
+	// rank orders the cursor among the others: pairs of equal keys are
+	// merged in the order of their cursors.
+	rank   int
+	reader PairReader
+	// closer, if not nil, is closed once the merge is over.
+	closer io.Closer
+	head   Pair
+}
+
+// advance reads the next pair into head, and returns false at the end of the
+// sequence.
+func (c *pairCursor) advance() (bool, error) {
+	pair, err := c.reader.Read()
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	c.head = pair
+	return true, nil
+}
+
+// cursorHeap orders cursors by their head key, then by their rank.
+type cursorHeap []*pairCursor
+
+func (h cursorHeap) Len() int      { return len(h) }
+func (h cursorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h cursorHeap) Less(i, j int) bool {
+	a, b := h[i], h[j]
+	if a.head.Key != b.head.Key {
+		return a.head.Key < b.head.Key
+	}
+	return a.rank < b.rank
+}
+
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*pairCursor)) }
+
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// pairMerger k-way merges sequences of pairs sorted by key into a single
+// one, which is sorted by key too.
+type pairMerger struct {
+	cursors []*pairCursor
+	heap    cursorHeap
+}
+
+// newPairMerger merges `cursors`. If it fails, the cursors are closed.
+func newPairMerger(cursors []*pairCursor) (*pairMerger, error) {
+	m := &pairMerger{cursors: cursors}
+	for _, c := range cursors {
+		ok, err := c.advance()
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		if ok {
+			m.heap = append(m.heap, c)
+		}
+	}
+	heap.Init(&m.heap)
+	return m, nil
+}
+
+// Peek returns the next pair without consuming it, or false if there are no
+// pairs left.
+func (m *pairMerger) Peek() (Pair, bool) {
+	if len(m.heap) == 0 {
+		return Pair{}, false
+	}
+	return m.heap[0].head, true
+}
+
+// Read returns the next pair, or io.EOF if there are no pairs left.
+func (m *pairMerger) Read() (Pair, error) {
+	if len(m.heap) == 0 {
+		return Pair{}, io.EOF
+	}
+	c := m.heap[0]
+	pair := c.head
+	ok, err := c.advance()
+	if err != nil {
+		return Pair{}, err
+	}
+	if ok {
+		heap.Fix(&m.heap, 0)
+	} else {
+		heap.Pop(&m.heap)
+	}
+	return pair, nil
+}
+
+// Close closes the closers of the cursors.
+func (m *pairMerger) Close() {
+	for _, c := range m.cursors {
+		if c.closer != nil {
+			_ = c.closer.Close()
+		}
+	}
+}
+
+// slicePairReader reads pairs from a slice.
+type slicePairReader struct {
+	pairs []Pair
+}
+
+func (r *slicePairReader) Read() (Pair, error) {
+	if len(r.pairs) == 0 {
+		return Pair{}, io.EOF
+	}
+	pair := r.pairs[0]
+	r.pairs = r.pairs[1:]
+	return pair, nil
+}
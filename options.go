@@ -0,0 +1,308 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+// DriveOption configures optional behaviour of Run.
+type DriveOption func(*driveOptions)
+
+type driveOptions struct {
+	retry       RetryPolicy
+	speculation *SpeculationPolicy
+	shuffle     ShuffleMode
+	splitSize   int64
+	mapperURLs  []string
+	reducerURLs []string
+	balancing   Balancing
+	health      HealthPolicy
+	maxMaps     int
+	maxReduces  int
+	inputFilter inputFilter
+	partitioner Partitioner
+	counters    Counters
+	sorted      bool
+	sampling    *SamplingPolicy
+	outputParts *[]*Resource
+
+	inputCodec  string
+	interCodec  string
+	outputCodec string
+
+	interCompression  string
+	outputCompression string
+}
+
+func newDriveOptions(opts []DriveOption) *driveOptions {
+	o := &driveOptions{
+		retry: RetryPolicy{MaxAttempts: 1},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRetryPolicy makes the driver retry failed MapBatch and ReduceBatch
+// invocations according to `policy`. By default, invocations are not retried.
+func WithRetryPolicy(policy RetryPolicy) DriveOption {
+	return func(o *driveOptions) {
+		o.retry = policy
+	}
+}
+
+// WithSpeculation enables speculative execution of straggling mappers and
+// reducers according to `policy`.
+func WithSpeculation(policy SpeculationPolicy) DriveOption {
+	return func(o *driveOptions) {
+		o.speculation = &policy
+	}
+}
+
+// WithMaxConcurrency bounds the number of map and reduce invocations,
+// including retries and speculative duplicates, that are in flight at a
+// time. Tasks beyond the bounds are queued and launched in order as others
+// finish. By default, or if a bound is zero, all tasks of a phase are
+// launched at once.
+func WithMaxConcurrency(maxMaps, maxReduces int) DriveOption {
+	return func(o *driveOptions) {
+		o.maxMaps = maxMaps
+		o.maxReduces = maxReduces
+	}
+}
+
+// WithWorkers makes the driver send map tasks to the `mappers` endpoints and
+// reduce tasks to the `reducers` endpoints, instead of to the worker URL(s)
+// passed to Run. An empty list keeps the default for its phase.
+func WithWorkers(mappers, reducers []string) DriveOption {
+	return func(o *driveOptions) {
+		o.mapperURLs = mappers
+		o.reducerURLs = reducers
+	}
+}
+
+// WithBalancing selects how tasks are spread across the endpoints of each
+// phase. The default is BalanceRoundRobin.
+func WithBalancing(balancing Balancing) DriveOption {
+	return func(o *driveOptions) {
+		o.balancing = balancing
+	}
+}
+
+// WithHealthPolicy configures when endpoints are deemed unhealthy and
+// skipped. By default, an endpoint is skipped for 30 seconds after 3
+// failures in a row.
+func WithHealthPolicy(policy HealthPolicy) DriveOption {
+	return func(o *driveOptions) {
+		o.health = policy
+	}
+}
+
+// WithPartitioner makes the driver split keys among reducers with
+// `partitioner` in keyed shuffles. In partitioned shuffles, keys are assigned
+// by the workers instead, so the driver refuses to run those unless the
+// workers are given the partitioner too; see WorkPartitioner.
+func WithPartitioner(partitioner Partitioner) DriveOption {
+	return func(o *driveOptions) {
+		o.partitioner = partitioner
+	}
+}
+
+// WithCounters makes the driver add the counters reported by the workers to
+// `counters`.
+func WithCounters(counters Counters) DriveOption {
+	return func(o *driveOptions) {
+		o.counters = counters
+	}
+}
+
+// WithCodecs selects the codecs of the input, intermediate and output
+// resources by name; see RegisterCodec. Empty names stand for TSV.
+func WithCodecs(input, intermediate, output string) DriveOption {
+	return func(o *driveOptions) {
+		o.inputCodec = input
+		o.interCodec = intermediate
+		o.outputCodec = output
+	}
+}
+
+// WithCompression makes the intermediate and output resources compressed
+// with the named compressions: either one of "gzip", "zstd", or "snappy".
+// Empty names stand for no compression. Compressed inputs are detected
+// automatically.
+func WithCompression(intermediate, output string) DriveOption {
+	return func(o *driveOptions) {
+		o.interCompression = intermediate
+		o.outputCompression = output
+	}
+}
+
+// WithShuffle selects how map outputs are routed to reducers. The default is
+// ShuffleKeys.
+func WithShuffle(mode ShuffleMode) DriveOption {
+	return func(o *driveOptions) {
+		o.shuffle = mode
+	}
+}
+
+// WithSplitSize makes the driver split FILE and S3 inputs larger than
+// `splitSize` bytes into splits of about `splitSize` bytes, at line
+// boundaries, each of which is mapped by a mapper of its own. Only inputs
+// encoded with a SplittableCodec are split, and compressed inputs never are.
+// By default, or if `splitSize` is zero, every input is mapped whole.
+func WithSplitSize(splitSize int64) DriveOption {
+	return func(o *driveOptions) {
+		o.splitSize = splitSize
+	}
+}
+
+// WithInputFilter filters the inputs that input patterns expand into by
+// their base names: only those matching at least one of the `include` glob
+// patterns, if any, and none of the `exclude` ones are mapped. Inputs listed
+// explicitly are not filtered; see Run.
+func WithInputFilter(include, exclude []string) DriveOption {
+	return func(o *driveOptions) {
+		o.inputFilter = inputFilter{include: include, exclude: exclude}
+	}
+}
+
+// WithSortedOutput makes reducers process their keys in sorted order, and
+// the driver k-way merge the outputs of the reducers by key instead of
+// concatenating them. The final output is thus sorted by key, provided that
+// reducers emit pairs keyed by the key they are called with, as is the norm.
+// Pairs of equal keys are merged in the order of the reducers.
+func WithSortedOutput() DriveOption {
+	return func(o *driveOptions) {
+		o.sorted = true
+	}
+}
+
+// WithTotalOrder makes the driver range partition keys by split points
+// computed from a sample of the keys, so that every reducer holds only keys
+// smaller than those of the next one, and the reducers are about equally
+// loaded. Keys are sampled according to `policy`. Reducers process their
+// keys in sorted order, so the final output is sorted by key, as with
+// WithSortedOutput, but is put together without a merge. In keyed shuffles,
+// it overrides WithPartitioner; in partitioned shuffles, mappers partition
+// their outputs by the split points instead of by their partitioners.
+func WithTotalOrder(policy SamplingPolicy) DriveOption {
+	return func(o *driveOptions) {
+		o.sampling = &policy
+	}
+}
+
+// WithOutputParts makes the driver leave the outputs of the reducers as part
+// files instead of putting them together into a final output: they are
+// stored in `parts`, in the order of the reducers, and Run returns a nil
+// resource. Combined with WithSortedOutput, every part is sorted by key.
+func WithOutputParts(parts *[]*Resource) DriveOption {
+	return func(o *driveOptions) {
+		o.outputParts = parts
+	}
+}
+
+// WorkOption configures optional behaviour of Work.
+type WorkOption func(*mareServer)
+
+// WorkMapOnly makes the worker serve MapBatch requests only, e.g. for a
+// deployment dedicated to mappers of a binary that implements both.
+func WorkMapOnly() WorkOption {
+	return func(m *mareServer) {
+		m.reducer = nil
+	}
+}
+
+// WorkReduceOnly makes the worker serve ReduceBatch requests only.
+func WorkReduceOnly() WorkOption {
+	return func(m *mareServer) {
+		m.mapper = nil
+	}
+}
+
+// WorkMapParallelism makes the worker run up to `n` Map calls at a time
+// within a MapBatch, e.g. for CPU-heavy mappers on multi-core instances. The
+// output is the same as when mapping serially, which is the default; the
+// mapper must be safe for concurrent use.
+func WorkMapParallelism(n int) WorkOption {
+	return func(m *mareServer) {
+		m.mapParallelism = n
+	}
+}
+
+// WorkReduceParallelism makes the worker run up to `n` Reduce calls, each
+// for a different key, at a time within a ReduceBatch. The output is the
+// same as when reducing serially, which is the default; the reducer must be
+// safe for concurrent use.
+func WorkReduceParallelism(n int) WorkOption {
+	return func(m *mareServer) {
+		m.reduceParallelism = n
+	}
+}
+
+// WorkFetchConcurrency makes the worker read up to `n` inputs at a time
+// within a ReduceBatch; the default is 4.
+func WorkFetchConcurrency(n int) WorkOption {
+	return func(m *mareServer) {
+		m.fetchConcurrency = n
+	}
+}
+
+// WorkMemoryBudget makes the worker sort-merge the inputs of a ReduceBatch
+// through run files whenever they take more than about `bytes` bytes of
+// memory, instead of grouping them in memory, so that reducers whose inputs
+// do not fit in memory succeed. Only the values of a single key have to fit.
+// Keys are then reduced in sorted order, even in keyed shuffles.
+func WorkMemoryBudget(bytes int64) WorkOption {
+	return func(m *mareServer) {
+		m.memoryBudget = bytes
+	}
+}
+
+// WorkSpillDir makes the worker spill run files into `dir` rather than into
+// the default directory for temporary files; see WorkMemoryBudget.
+func WorkSpillDir(dir string) WorkOption {
+	return func(m *mareServer) {
+		m.spillDir = dir
+	}
+}
+
+// WorkPartitioner makes the worker partition map outputs with `partitioner`
+// in partitioned shuffles. The default is HashPartitioner. As keys are split
+// by the driver in keyed shuffles, the driver refuses to run those unless it
+// is given the partitioner too; see WithPartitioner.
+func WorkPartitioner(partitioner Partitioner) WorkOption {
+	return func(m *mareServer) {
+		m.partitioner = partitioner
+	}
+}
+
+// WorkCombiner makes the worker pre-aggregate map outputs with `combiner`.
+func WorkCombiner(combiner Combiner) WorkOption {
+	return func(m *mareServer) {
+		m.combiner = combiner
+	}
+}
+
+// WorkStrictTSV makes the worker fail on malformed lines in its inputs,
+// instead of reading them leniently; see UnmarshalPairsStrict.
+func WorkStrictTSV() WorkOption {
+	return func(m *mareServer) {
+		m.strictTSV = true
+	}
+}
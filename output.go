@@ -0,0 +1,211 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// pairResourceWriter writes pairs into a new resource.
+type pairResourceWriter struct {
+	resource ResourceWriter
+	pairs    PairWriter
+}
+
+func createPairResource(ctx context.Context, hint *ResourceHint) (*pairResourceWriter, error) {
+	codec, err := LookupCodec(hint.Codec)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := hint.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pairResourceWriter{resource: resource, pairs: codec.NewWriter(resource)}, nil
+}
+
+// newPairReader returns a reader of the pairs in `r`, the contents of
+// `input`. If `strictTSV` is set, malformed TSV lines are errors.
+func newPairReader(input *Resource, r io.Reader, strictTSV bool) (PairReader, error) {
+	codec, err := LookupCodec(input.Codec)
+	if err != nil {
+		return nil, err
+	}
+	reader := codec.NewReader(r)
+	if tsvReader, ok := reader.(*TSVReader); ok {
+		tsvReader.Strict = strictTSV
+	}
+	return reader, nil
+}
+
+func (w *pairResourceWriter) Write(pair Pair) error {
+	return w.pairs.Write(pair)
+}
+
+func (w *pairResourceWriter) Close() (*Resource, error) {
+	if err := w.pairs.Flush(); err != nil {
+		_ = w.resource.Abort()
+		return nil, errors.Wrap(err, "failed to write")
+	}
+	if err := w.resource.Close(); err != nil {
+		return nil, err
+	}
+	return w.resource.Resource(), nil
+}
+
+func (w *pairResourceWriter) Abort() {
+	_ = w.resource.Abort()
+}
+
+// readPairs streams all pairs of `input` to `f`, stopping at the first error.
+func readPairs(ctx context.Context, input *Resource, strictTSV bool, f func(pair Pair) error) error {
+	r, err := input.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	reader, err := newPairReader(input, r, strictTSV)
+	if err != nil {
+		return err
+	}
+	for {
+		pair, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := f(pair); err != nil {
+			return err
+		}
+	}
+}
+
+// mapOutput writes the output of a MapBatch as it is produced, either into a
+// single resource while keeping track of its unique keys, or into one
+// resource per partition.
+type mapOutput struct {
+	ctx         context.Context
+	hint        *ResourceHint
+	partitioner Partitioner
+	nPartitions int
+
+	keys    map[string]interface{}
+	writers []*pairResourceWriter
+	nPairs  int
+}
+
+func newMapOutput(ctx context.Context, hint *ResourceHint, partitioner Partitioner, nPartitions int) *mapOutput {
+	o := &mapOutput{
+		ctx:         ctx,
+		hint:        hint,
+		partitioner: partitioner,
+		nPartitions: nPartitions,
+	}
+	if nPartitions > 0 {
+		o.writers = make([]*pairResourceWriter, nPartitions)
+	} else {
+		o.keys = make(map[string]interface{})
+		o.writers = make([]*pairResourceWriter, 1)
+	}
+	return o
+}
+
+func (o *mapOutput) Write(pair Pair) error {
+	i := 0
+	if o.nPartitions > 0 {
+		i = o.partitioner.Partition(pair.Key, o.nPartitions)
+		if i < 0 || i >= o.nPartitions {
+			return fmt.Errorf("partitioner assigned key %q to partition %d out of %d", pair.Key, i, o.nPartitions)
+		}
+	} else {
+		o.keys[pair.Key] = nil
+	}
+
+	if o.writers[i] == nil {
+		w, err := createPairResource(o.ctx, o.hint)
+		if err != nil {
+			return errors.Wrap(err, "failed to create output")
+		}
+		o.writers[i] = w
+	}
+	o.nPairs++
+	return o.writers[i].Write(pair)
+}
+
+// Close finishes writing and returns the response to the MapBatch request.
+// Empty partitions are returned with the NULL backend.
+func (o *mapOutput) Close() (*MapBatchResponse, error) {
+	if o.nPartitions == 0 && o.writers[0] == nil {
+		// Still create an (empty) output as the driver expects one.
+		w, err := createPairResource(o.ctx, o.hint)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create output")
+		}
+		o.writers[0] = w
+	}
+
+	resources := make([]*Resource, len(o.writers))
+	for i, w := range o.writers {
+		if w == nil {
+			resources[i] = &Resource{Backend: ResourceBackend_NULL}
+			continue
+		}
+		resource, err := w.Close()
+		if err != nil {
+			for _, w := range o.writers[i+1:] {
+				if w != nil {
+					w.Abort()
+				}
+			}
+			discardPartitions(context.Background(), resources[:i])
+			return nil, errors.Wrap(err, "failed to put output")
+		}
+		resources[i] = resource
+	}
+
+	if o.nPartitions > 0 {
+		return &MapBatchResponse{Partitions: resources}, nil
+	}
+	return &MapBatchResponse{Output: resources[0], Keys: MapKeys(o.keys)}, nil
+}
+
+// Abort discards everything written so far.
+func (o *mapOutput) Abort() {
+	for _, w := range o.writers {
+		if w != nil {
+			w.Abort()
+		}
+	}
+}
+
+func discardPartitions(ctx context.Context, partitions []*Resource) {
+	for _, partition := range partitions {
+		if partition != nil && partition.Backend != ResourceBackend_NULL {
+			discardOutput(ctx, partition)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// ShuffleMode determines how map outputs are routed to reducers.
+type ShuffleMode int
+
+const (
+	// ShuffleKeys makes every mapper return all of its unique keys to the
+	// driver, which splits them among the reducers; every reducer then reads
+	// every mapper output in full.
+	ShuffleKeys ShuffleMode = iota
+	// ShufflePartitioned makes every mapper write one output per reducer,
+	// and every reducer read only its own partition of each mapper output.
+	// Keys never go through the driver.
+	ShufflePartitioned
+)
+
+// HashPartitioner assigns keys to partitions by their FNV-1a hash.
+type HashPartitioner struct{}
+
+func (HashPartitioner) Partition(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// RangePartitioner assigns keys to partitions by comparing them to sorted
+// split points: partition i holds the keys k with
+// SplitPoints[i-1] <= k < SplitPoints[i]. It is meant to be used with
+// len(SplitPoints) + 1 partitions; any excess ranges fall into the last
+// partition.
+type RangePartitioner struct {
+	SplitPoints []string
+}
+
+func (r RangePartitioner) Partition(key string, n int) int {
+	i := sort.Search(len(r.SplitPoints), func(i int) bool {
+		return key < r.SplitPoints[i]
+	})
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// partitionKeys splits `keys` into `n` keysets.
+func partitionKeys(partitioner Partitioner, keys []string, n int) ([][]string, error) {
+	keySets := make([][]string, n)
+	for _, key := range keys {
+		i := partitioner.Partition(key, n)
+		if i < 0 || i >= n {
+			return nil, fmt.Errorf("partitioner assigned key %q to partition %d out of %d", key, i, n)
+		}
+		keySets[i] = append(keySets[i], key)
+	}
+	return keySets, nil
+}
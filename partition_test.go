@@ -0,0 +1,127 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"testing"
+)
+
+func TestRangePartitioner(t *testing.T) {
+	partitioner := RangePartitioner{SplitPoints: []string{"b", "d", "f"}}
+	tests := []struct {
+		key  string
+		n    int
+		want int
+	}{
+		{"", 4, 0},
+		{"a", 4, 0},
+		{"az", 4, 0},
+		{"b", 4, 1},
+		{"c", 4, 1},
+		{"d", 4, 2},
+		{"e", 4, 2},
+		{"f", 4, 3},
+		{"z", 4, 3},
+		// Excess ranges fall into the last partition.
+		{"a", 2, 0},
+		{"b", 2, 1},
+		{"z", 2, 1},
+		{"z", 1, 0},
+	}
+	for _, test := range tests {
+		if got := partitioner.Partition(test.key, test.n); got != test.want {
+			t.Errorf("Partition(%q, %d) = %d, want %d", test.key, test.n, got, test.want)
+		}
+	}
+
+	if got := (RangePartitioner{}).Partition("k", 3); got != 0 {
+		t.Errorf("Partition without split points = %d, want 0", got)
+	}
+}
+
+func TestHashPartitionerInRange(t *testing.T) {
+	for _, key := range []string{"", "a", "key", "\xff\x00"} {
+		for n := 1; n <= 5; n++ {
+			if i := (HashPartitioner{}).Partition(key, n); i < 0 || i >= n {
+				t.Errorf("Partition(%q, %d) = %d, out of range", key, n, i)
+			}
+		}
+	}
+}
+
+// fixedPartitioner assigns every key to the same partition.
+type fixedPartitioner int
+
+func (p fixedPartitioner) Partition(string, int) int {
+	return int(p)
+}
+
+func TestPartitionKeys(t *testing.T) {
+	keySets, err := partitionKeys(RangePartitioner{SplitPoints: []string{"m"}}, []string{"a", "n", "b", "z"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keySets) != 2 || len(keySets[0]) != 2 || len(keySets[1]) != 2 ||
+		keySets[0][0] != "a" || keySets[0][1] != "b" || keySets[1][0] != "n" || keySets[1][1] != "z" {
+		t.Errorf("keysets = %q, want [[a b] [n z]]", keySets)
+	}
+
+	for _, partition := range []int{-1, 2, 3} {
+		if _, err := partitionKeys(fixedPartitioner(partition), []string{"k"}, 2); err == nil {
+			t.Errorf("assigning a key to partition %d out of 2 did not fail", partition)
+		}
+	}
+}
+
+func TestCheckPartitioners(t *testing.T) {
+	defaultWorkers := []*CapabilitiesResponse{{Map: true}, {Map: true}}
+	customWorkers := []*CapabilitiesResponse{{Map: true, CustomPartitioner: true}, {Map: true, CustomPartitioner: true}}
+	mixedWorkers := []*CapabilitiesResponse{{Map: true}, {Map: true, CustomPartitioner: true}}
+
+	tests := []struct {
+		name    string
+		opts    []DriveOption
+		workers []*CapabilitiesResponse
+		ok      bool
+	}{
+		{"keyed default", nil, defaultWorkers, true},
+		{"keyed custom workers", nil, customWorkers, false},
+		{"keyed mixed workers", nil, mixedWorkers, false},
+		{"keyed custom both", []DriveOption{WithPartitioner(fixedPartitioner(0))}, customWorkers, true},
+		{"keyed custom driver", []DriveOption{WithPartitioner(fixedPartitioner(0))}, defaultWorkers, true},
+		{"keyed total order", []DriveOption{WithTotalOrder(SamplingPolicy{})}, customWorkers, true},
+
+		{"partitioned default", []DriveOption{WithShuffle(ShufflePartitioned)}, defaultWorkers, true},
+		{"partitioned custom workers", []DriveOption{WithShuffle(ShufflePartitioned)}, customWorkers, true},
+		{"partitioned custom both", []DriveOption{WithShuffle(ShufflePartitioned), WithPartitioner(fixedPartitioner(0))}, customWorkers, true},
+		{"partitioned custom driver", []DriveOption{WithShuffle(ShufflePartitioned), WithPartitioner(fixedPartitioner(0))}, defaultWorkers, false},
+		{"partitioned custom driver mixed workers", []DriveOption{WithShuffle(ShufflePartitioned), WithPartitioner(fixedPartitioner(0))}, mixedWorkers, false},
+		{"partitioned hash driver", []DriveOption{WithShuffle(ShufflePartitioned), WithPartitioner(HashPartitioner{})}, defaultWorkers, true},
+		{"partitioned hash driver custom workers", []DriveOption{WithShuffle(ShufflePartitioned), WithPartitioner(HashPartitioner{})}, customWorkers, false},
+		{"partitioned total order", []DriveOption{WithShuffle(ShufflePartitioned), WithPartitioner(fixedPartitioner(0)), WithTotalOrder(SamplingPolicy{})}, defaultWorkers, true},
+	}
+	for _, test := range tests {
+		err := checkPartitioners(newDriveOptions(test.opts), test.workers)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: checkPartitioners = %v, want ok = %v", test.name, err, test.ok)
+		}
+	}
+}
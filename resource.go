@@ -23,15 +23,10 @@ package mare
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"net/url"
 	"os"
-	"path"
-	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -43,108 +38,181 @@ func init() {
 	}
 }
 
-func (x *Resource) Get(ctx context.Context) (string, error) {
+// Open returns a reader of the contents of the resource. The reader must be
+// closed by the caller.
+// Compressed resources are decompressed transparently.
+func (x *Resource) Open(ctx context.Context) (io.ReadCloser, error) {
+	if x.Length != 0 {
+		return x.openSplit(ctx)
+	}
+	r, err := x.openAt(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(x, r)
+}
+
+// openAt returns a reader of the raw contents of the resource, starting at
+// `offset` and, if `end` is non-zero, ending at `end` (exclusive) or at the
+// end of the resource, whichever is first. `offset` must be within the
+// resource.
+func (x *Resource) openAt(ctx context.Context, offset int64, end int64) (io.ReadCloser, error) {
 	switch x.Backend {
 	case ResourceBackend_FILE:
-		return getFileResource(x.Locator)
+		f, err := os.Open(x.Locator)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if end > 0 {
+			return &readCloser{Reader: io.LimitReader(f, end-offset), Closer: f}, nil
+		}
+		return f, nil
 	case ResourceBackend_S3:
-		return getS3Resource(ctx, x.Locator)
+		return openS3Resource(ctx, x.Locator, offset, end)
 	case ResourceBackend_XDT:
-		panic("NOT IMPLEMENTED YET")
+		r, err := openXDTResource(ctx, x.Locator)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil && err != io.EOF {
+			r.Close()
+			return nil, err
+		}
+		return r, nil
 	}
-	return "", fmt.Errorf("unknown backend: %d", x.Backend)
+	return nil, fmt.Errorf("unknown backend: %d", x.Backend)
 }
 
-func getFileResource(path string) (string, error) {
-	data, err := ioutil.ReadFile(path)
-	return string(data), err
+// size returns the size of the raw contents of the resource.
+func (x *Resource) size(ctx context.Context) (int64, error) {
+	switch x.Backend {
+	case ResourceBackend_FILE:
+		info, err := os.Stat(x.Locator)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	case ResourceBackend_S3:
+		return statS3Resource(ctx, x.Locator)
+	}
+	return 0, fmt.Errorf("cannot get the size of resources of backend: %s", x.Backend)
 }
 
-func getS3Resource(ctx context.Context, uri string) (string, error) {
-	parsed, err := parseS3URI(uri)
+// Get reads the whole resource into memory. Prefer Open for resources that
+// might be large.
+func (x *Resource) Get(ctx context.Context) (string, error) {
+	r, err := x.Open(ctx)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to parse S3 uri")
+		return "", err
 	}
+	defer r.Close()
 
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to load AWS config")
-	}
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
+
+// ResourceWriter writes a resource created by ResourceHint.Create.
+type ResourceWriter interface {
+	io.WriteCloser
+	// Abort discards everything written so far, instead of Close.
+	Abort() error
+	// Resource returns the resource written, once Close has succeeded.
+	Resource() *Resource
+}
 
-	s3Client := s3.NewFromConfig(cfg)
-	params := &s3.GetObjectInput{
-		Bucket: aws.String(parsed.Hostname()),
-		Key:    aws.String(parsed.Path),
+// Create returns a writer of a new resource, which is created as the writer
+// is closed. The resource is compressed if the hint says so.
+func (x *ResourceHint) Create(ctx context.Context) (ResourceWriter, error) {
+	codec, err := LookupCodec(x.Codec)
+	if err != nil {
+		return nil, err
 	}
-	resp, err := s3Client.GetObject(ctx, params)
+	compression, err := lookupCompression(x.Compression)
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to get object `%s`", uri)
+		return nil, err
+	}
+	extension := codec.Extension()
+	if compression != nil {
+		extension += compression.extension
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	return string(data), err
-}
-
-func (x *ResourceHint) Put(ctx context.Context, data string) (*Resource, error) {
+	var w ResourceWriter
 	switch x.Backend {
 	case ResourceBackend_FILE:
-		return putFileResource(x.Hint, data)
+		w, err = createFileResource(x.Hint, extension, codec.Name())
 	case ResourceBackend_S3:
-		return putS3Resource(ctx, x.Hint, data)
+		w, err = createS3Resource(ctx, x.Hint, extension, codec.Name())
 	case ResourceBackend_XDT:
-		panic("NOT IMPLEMENTED YET")
+		w, err = createXDTResource(x.Hint, codec.Name())
+	default:
+		return nil, fmt.Errorf("unknown backend: %d", x.Backend)
 	}
-	return nil, fmt.Errorf("unknown backend: %d", x.Backend)
-}
-
-func putFileResource(dirname string, data string) (*Resource, error) {
-	f, err := ioutil.TempFile(dirname, "mare-*.tsv")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create a temp file")
+		return nil, err
 	}
-	defer f.Close()
-	_, err = f.Write([]byte(data))
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to write")
+	if compression == nil {
+		return uncompressedResourceWriter{w}, nil
 	}
-	return &Resource{Backend: ResourceBackend_FILE, Locator: f.Name()}, nil
-}
 
-func putS3Resource(ctx context.Context, uri string, data string) (*Resource, error) {
-	parsed, err := parseS3URI(uri)
+	cw, err := compression.newWriter(w)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse S3 uri")
+		_ = w.Abort()
+		return nil, err
 	}
-	bucket := parsed.Hostname()
-	key := path.Join(parsed.Path, fmt.Sprintf("mare-%s.tsv", RandString(8)))
+	return &compressedResourceWriter{WriteCloser: cw, resource: w, compression: compression}, nil
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+// Put creates a new resource with the contents `data`.
+func (x *ResourceHint) Put(ctx context.Context, data string) (*Resource, error) {
+	w, err := x.Create(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to load AWS config")
+		return nil, err
 	}
-
-	s3Client := s3.NewFromConfig(cfg)
-	params := &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   strings.NewReader(data),
+	if _, err := io.WriteString(w, data); err != nil {
+		_ = w.Abort()
+		return nil, errors.Wrap(err, "failed to write")
 	}
-	_, err = s3Client.PutObject(ctx, params)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to put object")
+	if err := w.Close(); err != nil {
+		return nil, err
 	}
+	return w.Resource(), nil
+}
 
-	return &Resource{Backend: ResourceBackend_S3, Locator: fmt.Sprintf("s3://%s/%s", bucket, key)}, nil
+type fileResourceWriter struct {
+	*os.File
+	codec string
 }
 
-// parseS3URI is copied from Corral.
-func parseS3URI(uri string) (*url.URL, error) {
-	parsed, err := url.Parse(uri)
+func createFileResource(dirname string, extension string, codec string) (ResourceWriter, error) {
+	f, err := ioutil.TempFile(dirname, "mare-*"+extension)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse S3URI: %s", err)
+		return nil, errors.Wrap(err, "failed to create a temp file")
 	}
+	return &fileResourceWriter{File: f, codec: codec}, nil
+}
+
+func (w *fileResourceWriter) Abort() error {
+	_ = w.File.Close()
+	return os.Remove(w.Name())
+}
 
-	parsed.Path = strings.TrimPrefix(parsed.Path, "/")
+func (w *fileResourceWriter) Resource() *Resource {
+	return &Resource{Backend: ResourceBackend_FILE, Locator: w.Name(), Codec: w.codec}
+}
 
-	return parsed, err
+// Delete removes the resource from its backend.
+func (x *Resource) Delete(ctx context.Context) error {
+	switch x.Backend {
+	case ResourceBackend_FILE:
+		return os.Remove(x.Locator)
+	case ResourceBackend_S3:
+		return deleteS3Resource(ctx, x.Locator)
+	case ResourceBackend_XDT:
+		return deleteXDTResource(ctx, x.Locator)
+	}
+	return fmt.Errorf("unknown backend: %d", x.Backend)
 }
@@ -0,0 +1,169 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy describes how failed invocations are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values smaller than 1 are treated as 1.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after each attempt. Zero
+	// stands for 2, as in DefaultRetryPolicy; other values smaller than 1
+	// are treated as 1.
+	Multiplier float64
+	// Jitter is the fraction of the delay, in [0, 1], that is randomised.
+	Jitter float64
+	// RetryableCodes are the gRPC status codes that are retried; errors with
+	// any other code fail immediately. Nil stands for the codes of
+	// DefaultRetryPolicy; an empty, non-nil slice retries nothing.
+	RetryableCodes []codes.Code
+}
+
+// DefaultRetryPolicy returns a policy suitable for serverless workers, where
+// cold starts and scale-downs cause transient failures.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableCodes: []codes.Code{
+			codes.Unavailable,
+			codes.DeadlineExceeded,
+			codes.ResourceExhausted,
+			codes.Aborted,
+		},
+	}
+}
+
+// RetryError is returned when all attempts of an invocation have failed.
+type RetryError struct {
+	Attempts []error
+}
+
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "all %d attempts failed:", len(e.Attempts))
+	for i, err := range e.Attempts {
+		fmt.Fprintf(&b, " [attempt %d] %v;", i+1, err)
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// Cause returns the error of the last attempt.
+func (e *RetryError) Cause() error {
+	return e.Unwrap()
+}
+
+func (p *RetryPolicy) isRetryable(err error) bool {
+	retryableCodes := p.RetryableCodes
+	if retryableCodes == nil {
+		retryableCodes = DefaultRetryPolicy().RetryableCodes
+	}
+	code := status.Code(errors.Cause(err))
+	for _, c := range retryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before attempt number `attempt` + 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	} else if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(delay)
+}
+
+// sleep waits before attempt number `attempt` + 1 and reports whether `ctx`
+// is still alive afterwards.
+func (p *RetryPolicy) sleep(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(p.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// do calls `f` until it succeeds, it fails with an error that is not
+// retryable, the attempts are exhausted, or `ctx` is done. Each attempt is
+// traced in a span of its own, named after `spanName`.
+func (p *RetryPolicy) do(ctx context.Context, spanName string, f func(ctx context.Context) error) error {
+	var attempts []error
+	for attempt := 1; ; attempt++ {
+		span := MakeSpan(fmt.Sprintf("%s.attempt-%d", spanName, attempt))
+		err := f(StartSpan(span, ctx))
+		EndSpan(span)
+		if err == nil {
+			return nil
+		}
+		attempts = append(attempts, err)
+
+		if attempt >= p.MaxAttempts || !p.isRetryable(err) || !p.sleep(ctx, attempt) {
+			break
+		}
+		logrus.Debugf("Retrying %s after attempt %d failed: %v", spanName, attempt, err)
+	}
+
+	if len(attempts) == 1 {
+		return attempts[0]
+	}
+	return &RetryError{Attempts: attempts}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingCall returns a function for RetryPolicy.do that fails with `errs`
+// in order, then succeeds, and counts its calls in `calls`.
+func failingCall(calls *int, errs ...error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	unknown := status.Error(codes.Unknown, "unknown")
+
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		errs      []error
+		wantCalls int
+		// wantAttempts is the number of attempts listed in the *RetryError
+		// returned, 1 if the error of the single attempt is returned as is,
+		// and 0 if no error is returned.
+		wantAttempts int
+	}{
+		{"success", RetryPolicy{MaxAttempts: 3}, nil, 1, 0},
+		{"retryable then success", RetryPolicy{MaxAttempts: 3}, []error{unavailable, unavailable}, 3, 0},
+		{"not retryable", RetryPolicy{MaxAttempts: 3}, []error{unknown}, 1, 1},
+		{"retryable then not retryable", RetryPolicy{MaxAttempts: 3}, []error{unavailable, unknown}, 2, 2},
+		{"exhausted", RetryPolicy{MaxAttempts: 3}, []error{unavailable, unavailable, unavailable}, 3, 3},
+		{"single attempt", RetryPolicy{MaxAttempts: 1}, []error{unavailable}, 1, 1},
+		{"zero attempts", RetryPolicy{}, []error{unavailable}, 1, 1},
+		{"custom codes", RetryPolicy{MaxAttempts: 3, RetryableCodes: []codes.Code{codes.Unknown}}, []error{unknown, unavailable}, 2, 2},
+		{"no codes", RetryPolicy{MaxAttempts: 3, RetryableCodes: []codes.Code{}}, []error{unavailable}, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.policy.InitialBackoff = time.Millisecond
+			var calls int
+			err := test.policy.do(context.Background(), "test", failingCall(&calls, test.errs...))
+			if calls != test.wantCalls {
+				t.Errorf("called %d times, want %d", calls, test.wantCalls)
+			}
+
+			switch test.wantAttempts {
+			case 0:
+				if err != nil {
+					t.Errorf("returned %v, want nil", err)
+				}
+			case 1:
+				if err != test.errs[0] {
+					t.Errorf("returned %v, want %v", err, test.errs[0])
+				}
+			default:
+				var retryErr *RetryError
+				if !errors.As(err, &retryErr) {
+					t.Fatalf("returned %v, want a *RetryError", err)
+				}
+				if len(retryErr.Attempts) != test.wantAttempts {
+					t.Fatalf("%d attempts listed, want %d", len(retryErr.Attempts), test.wantAttempts)
+				}
+				for i, attemptErr := range retryErr.Attempts {
+					if attemptErr != test.errs[i] {
+						t.Errorf("attempt %d failed with %v, want %v", i+1, attemptErr, test.errs[i])
+					}
+				}
+				if last := test.errs[test.wantAttempts-1]; !errors.Is(err, last) {
+					t.Errorf("%v does not unwrap to the last error %v", err, last)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoCancelledDuringBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	var calls int
+	done := make(chan error)
+	go func() {
+		done <- policy.do(ctx, "test", failingCall(&calls, unavailable, unavailable))
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != unavailable {
+			t.Errorf("returned %v, want %v", err, unavailable)
+		}
+		if calls != 1 {
+			t.Errorf("called %d times, want 1", calls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("do did not return after its context was cancelled")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{RetryPolicy{InitialBackoff: time.Second}, 1, time.Second},
+		{RetryPolicy{InitialBackoff: time.Second}, 3, 4 * time.Second},
+		{RetryPolicy{InitialBackoff: time.Second, Multiplier: 3}, 3, 9 * time.Second},
+		{RetryPolicy{InitialBackoff: time.Second, Multiplier: 0.5}, 3, time.Second},
+		{RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}, 5, 3 * time.Second},
+	}
+	for _, test := range tests {
+		if got := test.policy.backoff(test.attempt); got != test.want {
+			t.Errorf("%+v: backoff(%d) = %v, want %v", test.policy, test.attempt, got, test.want)
+		}
+	}
+}
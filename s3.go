@@ -0,0 +1,763 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// S3Config configures the S3 backend, e.g. to use an S3-compatible server
+// such as MinIO instead of AWS. Empty fields fall back to the defaults of the
+// AWS SDK, or of mare for the transfer settings.
+type S3Config struct {
+	// Endpoint is the URL of the server, e.g. `http://localhost:9000`.
+	Endpoint string
+	Region   string
+	// UsePathStyle makes buckets be addressed by path rather than by
+	// hostname, as required by most S3-compatible servers.
+	UsePathStyle    bool
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// MultipartThreshold is the size above which objects are uploaded in
+	// parts of PartSize bytes, Concurrency parts at a time. Objects larger
+	// than PartSize are likewise downloaded in ranges of PartSize bytes.
+	// Objects being uploaded are buffered in memory, up to
+	// MultipartThreshold bytes until their upload starts, and up to
+	// Concurrency+1 parts afterwards.
+	MultipartThreshold int64
+	PartSize           int64
+	Concurrency        int
+}
+
+const (
+	defaultS3MultipartThreshold = 64 << 20
+	defaultS3PartSize           = 16 << 20
+	defaultS3Concurrency        = 4
+
+	// Limits imposed by S3 on multipart uploads.
+	minS3PartSize = 5 << 20
+	maxS3Parts    = 10000
+)
+
+func (cfg S3Config) multipartThreshold() int64 {
+	if cfg.MultipartThreshold <= 0 {
+		return defaultS3MultipartThreshold
+	}
+	return cfg.MultipartThreshold
+}
+
+func (cfg S3Config) partSize() int64 {
+	if cfg.PartSize <= 0 {
+		return defaultS3PartSize
+	}
+	if cfg.PartSize < minS3PartSize {
+		return minS3PartSize
+	}
+	return cfg.PartSize
+}
+
+func (cfg S3Config) concurrency() int {
+	if cfg.Concurrency <= 0 {
+		return defaultS3Concurrency
+	}
+	return cfg.Concurrency
+}
+
+// S3ConfigFromEnv returns the S3Config described by the envvars
+// MARE_S3_ENDPOINT, MARE_S3_REGION, MARE_S3_PATH_STYLE,
+// MARE_S3_ACCESS_KEY_ID, MARE_S3_SECRET_ACCESS_KEY,
+// MARE_S3_MULTIPART_THRESHOLD, MARE_S3_PART_SIZE, and MARE_S3_CONCURRENCY.
+func S3ConfigFromEnv() S3Config {
+	pathStyle, _ := strconv.ParseBool(os.Getenv("MARE_S3_PATH_STYLE"))
+	multipartThreshold, _ := strconv.ParseInt(os.Getenv("MARE_S3_MULTIPART_THRESHOLD"), 10, 64)
+	partSize, _ := strconv.ParseInt(os.Getenv("MARE_S3_PART_SIZE"), 10, 64)
+	concurrency, _ := strconv.Atoi(os.Getenv("MARE_S3_CONCURRENCY"))
+	return S3Config{
+		Endpoint:           os.Getenv("MARE_S3_ENDPOINT"),
+		Region:             os.Getenv("MARE_S3_REGION"),
+		UsePathStyle:       pathStyle,
+		AccessKeyID:        os.Getenv("MARE_S3_ACCESS_KEY_ID"),
+		SecretAccessKey:    os.Getenv("MARE_S3_SECRET_ACCESS_KEY"),
+		MultipartThreshold: multipartThreshold,
+		PartSize:           partSize,
+		Concurrency:        concurrency,
+	}
+}
+
+var (
+	s3ConfigMu      sync.RWMutex
+	s3Config        = S3ConfigFromEnv()
+	s3BucketConfigs = make(map[string]S3Config)
+)
+
+// SetS3Config replaces the S3Config of this process, which is read from the
+// environment by default. Note that it does not affect the workers, which
+// have to be configured through their environment.
+func SetS3Config(cfg S3Config) {
+	s3ConfigMu.Lock()
+	defer s3ConfigMu.Unlock()
+	s3Config = cfg
+}
+
+// SetS3BucketConfig sets the S3Config to use for `bucket` in this process,
+// instead of the one set by SetS3Config, e.g. when buckets are spread across
+// multiple endpoints.
+func SetS3BucketConfig(bucket string, cfg S3Config) {
+	s3ConfigMu.Lock()
+	defer s3ConfigMu.Unlock()
+	s3BucketConfigs[bucket] = cfg
+}
+
+func s3ConfigFor(bucket string) S3Config {
+	s3ConfigMu.RLock()
+	defer s3ConfigMu.RUnlock()
+	if cfg, ok := s3BucketConfigs[bucket]; ok {
+		return cfg
+	}
+	return s3Config
+}
+
+// s3Clients caches S3 clients by their S3Config so that the AWS config and
+// credentials are loaded once per process, rather than once per request.
+// Clients are safe for concurrent use.
+var (
+	s3ClientsMu sync.Mutex
+	s3Clients   = make(map[S3Config]*s3ClientEntry)
+)
+
+type s3ClientEntry struct {
+	once   sync.Once
+	client *s3.Client
+	err    error
+}
+
+// getS3Client returns the S3 client for `cfg`, creating it if need be.
+func getS3Client(ctx context.Context, cfg S3Config) (*s3.Client, error) {
+	// The transfer settings do not affect the client.
+	cfg.MultipartThreshold, cfg.PartSize, cfg.Concurrency = 0, 0, 0
+
+	s3ClientsMu.Lock()
+	entry, ok := s3Clients[cfg]
+	if !ok {
+		entry = new(s3ClientEntry)
+		s3Clients[cfg] = entry
+	}
+	s3ClientsMu.Unlock()
+
+	entry.once.Do(func() {
+		span := MakeSpan("s3: client-setup")
+		entry.client, entry.err = newS3Client(StartSpan(span, ctx), cfg)
+		EndSpan(span)
+	})
+	if entry.err != nil {
+		// Do not cache failures, which may well be transient.
+		s3ClientsMu.Lock()
+		if s3Clients[cfg] == entry {
+			delete(s3Clients, cfg)
+		}
+		s3ClientsMu.Unlock()
+		return nil, entry.err
+	}
+	return entry.client, nil
+}
+
+func newS3Client(ctx context.Context, cfg S3Config) (*s3.Client, error) {
+	var loadOptions []func(*config.LoadOptions) error
+	if cfg.Region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKeyID != "" {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load AWS config")
+	}
+
+	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(cfg.Endpoint, func(e *aws.Endpoint) {
+				e.HostnameImmutable = cfg.UsePathStyle
+			})
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	}), nil
+}
+
+// openS3Resource opens the object at `uri` from `offset` on, up to `end`
+// (exclusive) if it is non-zero. Objects are read in ranges of PartSize
+// bytes, the first of which also tells the size of the object.
+func openS3Resource(ctx context.Context, uri string, offset int64, end int64) (io.ReadCloser, error) {
+	parsed, err := parseS3URI(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse S3 uri")
+	}
+	bucket, key := parsed.Hostname(), parsed.Path
+
+	cfg := s3ConfigFor(bucket)
+	s3Client, err := getS3Client(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	firstEnd := offset + cfg.partSize()
+	if end > 0 && end < firstEnd {
+		firstEnd = end
+	}
+	firstParams := *params
+	firstParams.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, firstEnd-1))
+	resp, err := s3Client.GetObject(ctx, &firstParams)
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if offset == 0 && errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusRequestedRangeNotSatisfiable {
+			// No range of an empty object is satisfiable.
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, errors.Wrapf(err, "failed to get object `%s`", uri)
+	}
+
+	size, ok := parseContentRangeSize(aws.ToString(resp.ContentRange))
+	if !ok {
+		// The range was ignored, and the whole object returned.
+		return limitS3Body(resp.Body, offset, end)
+	}
+	stop := size
+	if end > 0 && end < stop {
+		stop = end
+	}
+	if offset+resp.ContentLength >= stop {
+		return resp.Body, nil
+	}
+
+	// Read the first range right away rather than holding its connection
+	// open while the other ranges are fetched.
+	first := make([]byte, resp.ContentLength)
+	_, err = io.ReadFull(resp.Body, first)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read object `%s`", uri)
+	}
+	return newS3RangeReader(ctx, s3Client, cfg, params, resp.ETag, first, offset+int64(len(first)), stop), nil
+}
+
+// parseContentRangeSize returns the size of the object from the
+// Content-Range of a response, e.g. 1234 from `bytes 0-99/1234`.
+func parseContentRangeSize(contentRange string) (int64, bool) {
+	i := strings.LastIndex(contentRange, "/")
+	if !strings.HasPrefix(contentRange, "bytes ") || i < 0 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	return size, err == nil
+}
+
+// limitS3Body returns the part of a whole object `body` from `offset` on, up
+// to `end` (exclusive) if it is non-zero.
+func limitS3Body(body io.ReadCloser, offset int64, end int64) (io.ReadCloser, error) {
+	if _, err := io.CopyN(ioutil.Discard, body, offset); err != nil && err != io.EOF {
+		body.Close()
+		return nil, errors.Wrap(err, "failed to read object")
+	}
+	if end == 0 {
+		return body, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(body, end-offset), body}, nil
+}
+
+func statS3Resource(ctx context.Context, uri string) (int64, error) {
+	parsed, err := parseS3URI(uri)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse S3 uri")
+	}
+
+	s3Client, err := getS3Client(ctx, s3ConfigFor(parsed.Hostname()))
+	if err != nil {
+		return 0, err
+	}
+
+	params := &s3.HeadObjectInput{
+		Bucket: aws.String(parsed.Hostname()),
+		Key:    aws.String(parsed.Path),
+	}
+	resp, err := s3Client.HeadObject(ctx, params)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to head object `%s`", uri)
+	}
+	return resp.ContentLength, nil
+}
+
+// listS3Resources returns the URIs of the objects whose keys match the glob
+// pattern in `uri`, as understood by path.Match, in lexical order.
+func listS3Resources(ctx context.Context, uri string) ([]string, error) {
+	// Not parsed as a URL, lest `?` be taken for the start of a query.
+	bucket, keyPattern := splitS3URI(uri)
+	if _, err := path.Match(keyPattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern `%s`", uri)
+	}
+
+	s3Client, err := getS3Client(ctx, s3ConfigFor(bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := keyPattern
+	if i := strings.IndexAny(keyPattern, `*?[\`); i >= 0 {
+		prefix = keyPattern[:i]
+	}
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	var uris []string
+	paginator := s3.NewListObjectsV2Paginator(s3Client, params)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list objects of `s3://%s/%s`", bucket, prefix)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if strings.HasSuffix(key, "/") {
+				// Folder placeholder.
+				continue
+			}
+			if ok, _ := path.Match(keyPattern, key); ok {
+				uris = append(uris, fmt.Sprintf("s3://%s/%s", bucket, key))
+			}
+		}
+	}
+	return uris, nil
+}
+
+// splitS3URI splits `uri` into its bucket and key.
+func splitS3URI(uri string) (bucket string, key string) {
+	rest := strings.TrimPrefix(uri, "s3://")
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return rest[:i], rest[i+1:]
+	}
+	return rest, ""
+}
+
+// s3RangeReader reads a large object, from `start` up to `stop`, in ranges
+// of PartSize bytes, fetching up to Concurrency ranges ahead of the reader.
+// The range before `start` has been read already.
+type s3RangeReader struct {
+	cancel context.CancelFunc
+	ranges chan chan s3Range
+	cur    io.Reader
+}
+
+type s3Range struct {
+	data []byte
+	err  error
+}
+
+func newS3RangeReader(ctx context.Context, s3Client *s3.Client, cfg S3Config, params *s3.GetObjectInput, etag *string, first []byte, start int64, stop int64) *s3RangeReader {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &s3RangeReader{
+		cancel: cancel,
+		ranges: make(chan chan s3Range, cfg.concurrency()-1),
+		cur:    bytes.NewReader(first),
+	}
+
+	partSize := cfg.partSize()
+	go func() {
+		defer close(r.ranges)
+		for ; start < stop; start += partSize {
+			length := partSize
+			if start+length > stop {
+				length = stop - start
+			}
+
+			result := make(chan s3Range, 1)
+			select {
+			case r.ranges <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(start int64, length int64) {
+				rangeParams := *params
+				rangeParams.Range = aws.String(fmt.Sprintf("bytes=%d-%d", start, start+length-1))
+				// Make sure that the object does not change under our feet.
+				rangeParams.IfMatch = etag
+				result <- getS3Range(ctx, s3Client, &rangeParams, length)
+			}(start, length)
+		}
+	}()
+
+	return r
+}
+
+func getS3Range(ctx context.Context, s3Client *s3.Client, params *s3.GetObjectInput, length int64) s3Range {
+	resp, err := s3Client.GetObject(ctx, params)
+	if err != nil {
+		return s3Range{nil, errors.Wrapf(err, "failed to get range %s of object", *params.Range)}
+	}
+	defer resp.Body.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return s3Range{nil, errors.Wrapf(err, "failed to read range %s of object", *params.Range)}
+	}
+	return s3Range{data, nil}
+}
+
+func (r *s3RangeReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.cur.Read(p)
+		if n > 0 {
+			return n, nil
+		} else if err != io.EOF {
+			return 0, err
+		}
+
+		result, ok := <-r.ranges
+		if !ok {
+			return 0, io.EOF
+		}
+		next := <-result
+		if next.err != nil {
+			return 0, next.err
+		}
+		r.cur = bytes.NewReader(next.data)
+	}
+}
+
+func (r *s3RangeReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// s3ResourceWriter uploads the object as it is written. Objects no larger
+// than MultipartThreshold are buffered and put at once on Close. Larger ones
+// are uploaded in parts of PartSize bytes as the parts fill, Concurrency
+// parts at a time, so that memory stays bounded and nothing is written to
+// local disk.
+type s3ResourceWriter struct {
+	ctx      context.Context
+	s3Client *s3.Client
+	cfg      S3Config
+	bucket   string
+	key      string
+	codec    string
+
+	// buf holds everything written until the upload is started, and the
+	// part being written afterwards.
+	buf    []byte
+	upload *s3Upload
+}
+
+// s3Upload is a multipart upload in progress.
+type s3Upload struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	id     *string
+
+	sem   chan struct{}
+	free  chan []byte
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	parts []types.CompletedPart
+	err   error
+}
+
+func createS3Resource(ctx context.Context, uri string, extension string, codec string) (ResourceWriter, error) {
+	parsed, err := parseS3URI(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse S3 uri")
+	}
+
+	cfg := s3ConfigFor(parsed.Hostname())
+	s3Client, err := getS3Client(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &s3ResourceWriter{
+		ctx:      ctx,
+		s3Client: s3Client,
+		cfg:      cfg,
+		bucket:   parsed.Hostname(),
+		key:      path.Join(parsed.Path, fmt.Sprintf("mare-%s%s", RandString(8), extension)),
+		codec:    codec,
+	}, nil
+}
+
+func (w *s3ResourceWriter) Write(p []byte) (int, error) {
+	if w.upload == nil {
+		w.buf = append(w.buf, p...)
+		if int64(len(w.buf)) <= w.cfg.multipartThreshold() {
+			return len(p), nil
+		}
+		if err := w.startUpload(); err != nil {
+			return 0, err
+		}
+		// Upload what has been buffered so far, but for the last, partial,
+		// part.
+		buffered := w.buf
+		w.buf = nil
+		if err := w.writeParts(buffered); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if err := w.writeParts(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeParts appends `p` to the part being written, and uploads the parts
+// that fill.
+func (w *s3ResourceWriter) writeParts(p []byte) error {
+	partSize := int(w.cfg.partSize())
+	for len(p) > 0 {
+		if w.buf == nil {
+			select {
+			case w.buf = <-w.upload.free:
+			default:
+				w.buf = make([]byte, 0, partSize)
+			}
+		}
+		n := partSize - len(w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		if len(w.buf) == partSize {
+			if err := w.uploadPart(w.buf); err != nil {
+				return err
+			}
+			w.buf = nil
+		}
+	}
+	return nil
+}
+
+func (w *s3ResourceWriter) startUpload() error {
+	created, err := w.s3Client.CreateMultipartUpload(w.ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(w.key),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create multipart upload")
+	}
+	logrus.Debugf("Uploading `s3://%s/%s` in parts...", w.bucket, w.key)
+
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.upload = &s3Upload{
+		ctx:    ctx,
+		cancel: cancel,
+		id:     created.UploadId,
+		sem:    make(chan struct{}, w.cfg.concurrency()),
+		free:   make(chan []byte, w.cfg.concurrency()),
+	}
+	return nil
+}
+
+// uploadPart uploads `data` as the next part in the background, once fewer
+// than Concurrency parts are being uploaded. It returns the error of any
+// part that failed so far.
+func (w *s3ResourceWriter) uploadPart(data []byte) error {
+	u := w.upload
+	select {
+	case u.sem <- struct{}{}:
+	case <-u.ctx.Done():
+	}
+	u.mu.Lock()
+	if u.err == nil && u.ctx.Err() != nil {
+		u.err = u.ctx.Err()
+	}
+	err := u.err
+	if err == nil && len(u.parts) == maxS3Parts {
+		err = fmt.Errorf("object exceeds %d parts of %d bytes; raise the part size", maxS3Parts, w.cfg.partSize())
+		u.err = err
+	}
+	if err != nil {
+		u.mu.Unlock()
+		return err
+	}
+	partNumber := int32(len(u.parts) + 1)
+	u.parts = append(u.parts, types.CompletedPart{PartNumber: partNumber})
+	u.mu.Unlock()
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		defer func() { <-u.sem }()
+
+		resp, err := w.s3Client.UploadPart(u.ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(w.bucket),
+			Key:           aws.String(w.key),
+			UploadId:      u.id,
+			PartNumber:    partNumber,
+			ContentLength: int64(len(data)),
+			Body:          bytes.NewReader(data),
+		})
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if err != nil {
+			if u.err == nil {
+				u.err = errors.Wrapf(err, "failed to upload part %d", partNumber)
+				u.cancel()
+			}
+			return
+		}
+		u.parts[partNumber-1].ETag = resp.ETag
+		select {
+		case u.free <- data[:0]:
+		default:
+		}
+	}()
+	return nil
+}
+
+func (w *s3ResourceWriter) Close() error {
+	if w.upload == nil {
+		params := &s3.PutObjectInput{
+			Bucket: aws.String(w.bucket),
+			Key:    aws.String(w.key),
+			Body:   bytes.NewReader(w.buf),
+		}
+		w.buf = nil
+		if _, err := w.s3Client.PutObject(w.ctx, params); err != nil {
+			return errors.Wrap(err, "failed to put object")
+		}
+		return nil
+	}
+
+	u := w.upload
+	var err error
+	if len(w.buf) > 0 {
+		err = w.uploadPart(w.buf)
+	}
+	w.buf = nil
+	u.wg.Wait()
+	if err == nil {
+		err = u.err
+	}
+	if err == nil {
+		_, err = w.s3Client.CompleteMultipartUpload(u.ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(w.bucket),
+			Key:             aws.String(w.key),
+			UploadId:        u.id,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: u.parts},
+		})
+		if err == nil {
+			u.cancel()
+			w.upload = nil
+			return nil
+		}
+		err = errors.Wrap(err, "failed to complete multipart upload")
+	}
+	_ = w.Abort()
+	return err
+}
+
+// Abort aborts the multipart upload, if any, lest the parts uploaded so far
+// be kept (and billed for).
+func (w *s3ResourceWriter) Abort() error {
+	w.buf = nil
+	u := w.upload
+	if u == nil {
+		return nil
+	}
+	w.upload = nil
+	u.cancel()
+	u.wg.Wait()
+	_, err := w.s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket),
+		Key:      aws.String(w.key),
+		UploadId: u.id,
+	})
+	if err != nil {
+		logrus.Warnf("Failed to abort multipart upload of `s3://%s/%s`: %v", w.bucket, w.key, err)
+	}
+	return err
+}
+
+func (w *s3ResourceWriter) Resource() *Resource {
+	return &Resource{Backend: ResourceBackend_S3, Locator: fmt.Sprintf("s3://%s/%s", w.bucket, w.key), Codec: w.codec}
+}
+
+func deleteS3Resource(ctx context.Context, uri string) error {
+	parsed, err := parseS3URI(uri)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse S3 uri")
+	}
+
+	s3Client, err := getS3Client(ctx, s3ConfigFor(parsed.Hostname()))
+	if err != nil {
+		return err
+	}
+
+	params := &s3.DeleteObjectInput{
+		Bucket: aws.String(parsed.Hostname()),
+		Key:    aws.String(parsed.Path),
+	}
+	if _, err := s3Client.DeleteObject(ctx, params); err != nil {
+		return errors.Wrapf(err, "failed to delete object `%s`", uri)
+	}
+	return nil
+}
+
+// parseS3URI is copied from Corral.
+func parseS3URI(uri string) (*url.URL, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse S3URI: %s", err)
+	}
+
+	parsed.Path = strings.TrimPrefix(parsed.Path, "/")
+
+	return parsed, err
+}
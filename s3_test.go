@@ -0,0 +1,159 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 serves objects to GetObject, honouring Range and If-Match, and
+// records the ranges requested.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	ranges  []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	data, ok := f.objects[r.URL.Path]
+	f.ranges = append(f.ranges, r.Header.Get("Range"))
+	f.mu.Unlock()
+
+	if r.Method != http.MethodGet || !ok {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	etag := fmt.Sprintf(`"%d"`, len(data))
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != etag {
+		http.Error(w, "", http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("ETag", etag)
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		w.Write(data)
+		return
+	}
+	var start, end int64
+	if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if start >= int64(len(data)) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		fmt.Fprint(w, "<Error><Code>InvalidRange</Code></Error>")
+		return
+	}
+	if end >= int64(len(data)) {
+		end = int64(len(data)) - 1
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+	w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[start : end+1])
+}
+
+func TestOpenS3Resource(t *testing.T) {
+	const partSize = minS3PartSize
+	data := make([]byte, 2*partSize+12345)
+	rand.New(rand.NewSource(1)).Read(data)
+	fake := &fakeS3{objects: map[string][]byte{
+		"/test-bucket/large": data,
+		"/test-bucket/small": data[:100],
+		"/test-bucket/empty": nil,
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	SetS3BucketConfig("test-bucket", S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		UsePathStyle:    true,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PartSize:        partSize,
+		Concurrency:     2,
+	})
+
+	size := int64(len(data))
+	tests := []struct {
+		key         string
+		offset, end int64
+		want        []byte
+	}{
+		{"large", 0, 0, data},
+		{"large", 1, 0, data[1:]},
+		{"large", partSize, 0, data[partSize:]},
+		{"large", partSize + 1, size - 1, data[partSize+1 : size-1]},
+		{"large", 10, 2*partSize + 10, data[10 : 2*partSize+10]},
+		{"large", 10, 20, data[10:20]},
+		{"large", 0, size + 100, data},
+		{"small", 0, 0, data[:100]},
+		{"small", 50, 0, data[50:100]},
+		{"small", 50, 60, data[50:60]},
+		{"empty", 0, 0, nil},
+	}
+	for _, test := range tests {
+		fake.mu.Lock()
+		fake.ranges = nil
+		fake.mu.Unlock()
+
+		uri := "s3://test-bucket/" + test.key
+		r, err := openS3Resource(context.Background(), uri, test.offset, test.end)
+		if err != nil {
+			t.Fatalf("%s [%d, %d): %v", uri, test.offset, test.end, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s [%d, %d): %v", uri, test.offset, test.end, err)
+		}
+		if string(got) != string(test.want) {
+			t.Errorf("%s [%d, %d) read %d bytes, want %d", uri, test.offset, test.end, len(got), len(test.want))
+		}
+
+		fake.mu.Lock()
+		for _, r := range fake.ranges {
+			var start, end int64
+			if _, err := fmt.Sscanf(r, "bytes=%d-%d", &start, &end); err != nil || end-start+1 > partSize {
+				t.Errorf("%s [%d, %d) requested range %q, want at most %d bytes", uri, test.offset, test.end, r, partSize)
+			}
+		}
+		if wantRanges := (int64(len(test.want)) + partSize - 1) / partSize; len(test.want) > 0 && int64(len(fake.ranges)) != wantRanges {
+			t.Errorf("%s [%d, %d) requested ranges %s, want %d", uri, test.offset, test.end, strings.Join(fake.ranges, ", "), wantRanges)
+		}
+		fake.mu.Unlock()
+	}
+
+	if _, err := openS3Resource(context.Background(), "s3://test-bucket/small", 200, 0); err == nil {
+		t.Error("opening an object past its end did not fail")
+	}
+}
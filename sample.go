@@ -0,0 +1,215 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSampleSize    = 1000
+	defaultSampleRecords = 10000
+)
+
+// SamplingPolicy configures how keys are sampled to compute the split points
+// of total-order partitioning; see WithTotalOrder.
+type SamplingPolicy struct {
+	// SampleSize is the number of keys sampled per map task; 1000 if zero.
+	SampleSize int
+	// SampleRecords is the number of input pairs, from the start of every
+	// input, that are mapped in a pre-pass; 10000 if zero, all of them if
+	// negative.
+	SampleRecords int
+	// PrePass makes the driver sample keys in a pre-pass over the inputs in
+	// keyed shuffles too, where keys are otherwise sampled from the keys the
+	// mappers return. Unlike the latter, which weighs every unique key
+	// equally, a pre-pass weighs keys by their number of pairs. Partitioned
+	// shuffles always take a pre-pass, as mappers need the split points
+	// before they can partition their outputs.
+	PrePass bool
+}
+
+func (p SamplingPolicy) sampleSize() int {
+	if p.SampleSize <= 0 {
+		return defaultSampleSize
+	}
+	return p.SampleSize
+}
+
+func (p SamplingPolicy) sampleRecords() int {
+	if p.SampleRecords == 0 {
+		return defaultSampleRecords
+	} else if p.SampleRecords < 0 {
+		return 0
+	}
+	return p.SampleRecords
+}
+
+// reservoir is a uniform random sample of a fixed size of a stream of keys.
+// It is seeded deterministically so that jobs are partitioned alike across
+// runs.
+type reservoir struct {
+	size int
+	keys []string
+	n    int
+	rand *rand.Rand
+}
+
+func newReservoir(size int) *reservoir {
+	return &reservoir{size: size, rand: rand.New(rand.NewSource(1))}
+}
+
+func (r *reservoir) add(key string) {
+	r.n++
+	if len(r.keys) < r.size {
+		r.keys = append(r.keys, key)
+	} else if i := r.rand.Intn(r.n); i < r.size {
+		r.keys[i] = key
+	}
+}
+
+// limitedPairReader reads at most n pairs from a PairReader.
+type limitedPairReader struct {
+	r PairReader
+	n int
+}
+
+func (l *limitedPairReader) Read() (Pair, error) {
+	if l.n <= 0 {
+		return Pair{}, io.EOF
+	}
+	l.n--
+	return l.r.Read()
+}
+
+// sampleBatch serves a MapBatch request that is a sampling pre-pass.
+func (m *mareServer) sampleBatch(ctx context.Context, request *MapBatchRequest) (*MapBatchResponse, error) {
+	span := MakeSpan("worker: map.sample")
+	ctx = StartSpan(span, ctx)
+	defer EndSpan(span)
+
+	input, err := request.Input.Open(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get input")
+	}
+	defer input.Close()
+
+	reader, err := newPairReader(request.Input, input, m.strictTSV)
+	if err != nil {
+		return nil, err
+	}
+	if request.SampleRecords > 0 {
+		reader = &limitedPairReader{r: reader, n: int(request.SampleRecords)}
+	}
+
+	sample := newReservoir(int(request.SampleSize))
+	nInputPairs, err := m.mapAll(ctx, reader, func(pair Pair) error {
+		sample.add(pair.Key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("Mapper sampled %d keys from %d output pairs of %d input pairs...", len(sample.keys), sample.n, nInputPairs)
+
+	return &MapBatchResponse{Keys: sample.keys}, nil
+}
+
+// sampleInputs samples keys in a pre-pass over `inputs`, in which mappers
+// map a prefix of every input without writing any output.
+func sampleInputs(ctx context.Context, mappers *endpointPool, inputs []*Resource, options *driveOptions) ([]string, error) {
+	tasks := make([]task, len(inputs))
+	for i, input := range inputs {
+		request := &MapBatchRequest{
+			Input:         input,
+			SampleSize:    int32(options.sampling.sampleSize()),
+			SampleRecords: int32(options.sampling.sampleRecords()),
+		}
+		tasks[i] = task{
+			run: func(ctx context.Context) (interface{}, error) {
+				var resp *MapBatchResponse
+				err := options.retry.do(ctx, "driver: sample.invoke", func(ctx context.Context) (err error) {
+					mapper := mappers.acquire()
+					resp, err = invokeMapper(ctx, mapper.url, request)
+					mappers.release(ctx, mapper, err)
+					return
+				})
+				return resp, err
+			},
+		}
+	}
+
+	span := MakeSpan("driver: map.sample")
+	ctx = StartSpan(span, ctx)
+	results, err := runTasks(ctx, "sample", tasks, schedule{
+		speculation:    options.speculation,
+		maxConcurrency: options.maxMaps,
+		counters:       options.counters,
+	})
+	EndSpan(span)
+	if err != nil {
+		taskErr := err.(*taskError)
+		return nil, &JobError{Phase: PhaseMap, Input: inputs[taskErr.index], Err: errors.Wrap(taskErr.err, "failed to sample")}
+	}
+
+	var samples []string
+	for _, result := range results {
+		samples = append(samples, result.(*MapBatchResponse).Keys...)
+	}
+	return samples, nil
+}
+
+// sampleMapKeys samples the keys returned by every mapper.
+func sampleMapKeys(mapResponses []*MapBatchResponse, sampleSize int) []string {
+	var samples []string
+	for _, mapResponse := range mapResponses {
+		sample := newReservoir(sampleSize)
+		for _, key := range mapResponse.Keys {
+			sample.add(key)
+		}
+		samples = append(samples, sample.keys...)
+	}
+	return samples
+}
+
+// computeSplitPoints computes the split points that divide `samples` into
+// `n` ranges of about equal size, for a RangePartitioner. Keys that are too
+// frequent to be split among ranges may yield fewer than n-1 split points,
+// in which case the last partitions are left empty.
+func computeSplitPoints(samples []string, n int) []string {
+	sort.Strings(samples)
+	var splitPoints []string
+	for i := 1; i < n && len(samples) > 0; i++ {
+		splitPoint := samples[i*len(samples)/n]
+		if len(splitPoints) > 0 && splitPoint <= splitPoints[len(splitPoints)-1] {
+			continue
+		}
+		splitPoints = append(splitPoints, splitPoint)
+	}
+	return splitPoints
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tracing "github.com/ease-lab/vhive/utils/tracing/go"
+	"github.com/sirupsen/logrus"
+)
+
+// SpeculationPolicy configures speculative execution of straggling tasks.
+type SpeculationPolicy struct {
+	// Threshold is the fraction of the tasks of a phase, in (0, 1], that
+	// must have finished before duplicates are launched for the remaining
+	// ones.
+	Threshold float64
+}
+
+// task is a single map or reduce invocation, possibly attempted more than
+// once when speculating.
+type task struct {
+	run func(ctx context.Context) (interface{}, error)
+	// discard releases the result of an attempt that lost to another attempt
+	// of the same task. May be nil.
+	discard func(ctx context.Context, result interface{})
+}
+
+// taskError is returned by runTasks when all attempts of a task have failed.
+type taskError struct {
+	index int
+	err   error
+}
+
+func (e *taskError) Error() string {
+	return e.err.Error()
+}
+
+type taskAttempt struct {
+	index  int
+	result interface{}
+	err    error
+}
+
+// schedule configures how runTasks runs the tasks of a phase.
+type schedule struct {
+	speculation *SpeculationPolicy
+	// maxConcurrency bounds the number of attempts running at a time;
+	// attempts beyond it are queued in order. Zero means no bound.
+	maxConcurrency int
+	// counters, if not nil, accumulate the queueing delays of the tasks as
+	// CounterMapQueueMillis or CounterReduceQueueMillis.
+	counters Counters
+}
+
+// runTasks runs `tasks` concurrently and returns their results in order. If
+// `sched.speculation` is not nil, once enough tasks have finished and none
+// is queued anymore, a duplicate of every unfinished task is launched and
+// whichever attempt finishes first wins; the other attempt is cancelled and
+// its result, if any, discarded.
+//
+// The time every task spends queued, until its first attempt is launched,
+// is traced and logged.
+//
+// If a task fails, all other tasks are cancelled, the results of those that
+// finished are discarded, and a *taskError is returned.
+func runTasks(ctx context.Context, phase string, tasks []task, sched schedule) ([]interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so that no attempt blocks, even after we stopped listening.
+	attemptCh := make(chan taskAttempt, 2*len(tasks))
+	attemptCancels := make([][]context.CancelFunc, len(tasks))
+	running := make([]int, len(tasks))
+	nRunning := 0
+
+	results := make([]interface{}, len(tasks))
+	finished := make([]bool, len(tasks))
+	nFinished := 0
+
+	// queue holds the indices of the tasks (or of their duplicates) that
+	// wait for an attempt to finish before being launched.
+	queue := make([]int, len(tasks))
+	queueSpans := make([]tracing.Span, len(tasks))
+	launched := make([]bool, len(tasks))
+	queuedAt := time.Now()
+	var queueDelay time.Duration
+	for i := range tasks {
+		queue[i] = i
+		queueSpans[i] = MakeSpan(fmt.Sprintf("driver: %s.queue", phase))
+		StartSpan(queueSpans[i], ctx)
+	}
+
+	launch := func(i int) {
+		if !launched[i] {
+			launched[i] = true
+			EndSpan(queueSpans[i])
+			delay := time.Since(queuedAt)
+			queueDelay += delay
+			logrus.Debugf("Launching %s task %d after %v in queue...", phase, i, delay)
+		}
+
+		attemptCtx, attemptCancel := context.WithCancel(ctx)
+		attemptCancels[i] = append(attemptCancels[i], attemptCancel)
+		running[i]++
+		nRunning++
+		go func() {
+			result, err := tasks[i].run(attemptCtx)
+			attemptCh <- taskAttempt{index: i, result: result, err: err}
+		}()
+	}
+	launchQueued := func() {
+		for len(queue) > 0 && (sched.maxConcurrency <= 0 || nRunning < sched.maxConcurrency) {
+			i := queue[0]
+			queue = queue[1:]
+			// Duplicates of tasks that have finished meanwhile are dropped.
+			if !finished[i] {
+				launch(i)
+			}
+		}
+	}
+
+	// Attempts that are still running once we return lose by definition.
+	defer func() {
+		if nRunning > 0 {
+			go discardAttempts(tasks, attemptCh, nRunning)
+		}
+		for i := range tasks {
+			if !launched[i] {
+				EndSpan(queueSpans[i])
+			}
+		}
+	}()
+
+	launchQueued()
+
+	speculated := sched.speculation == nil
+	for nFinished < len(tasks) {
+		attempt := <-attemptCh
+		running[attempt.index]--
+		nRunning--
+
+		if finished[attempt.index] {
+			discardAttempt(tasks[attempt.index], attempt)
+			launchQueued()
+			continue
+		}
+		if attempt.err != nil {
+			if running[attempt.index] > 0 || isQueued(queue, attempt.index) {
+				// Wait for the other attempt of this task.
+				launchQueued()
+				continue
+			}
+			for i, result := range results {
+				if finished[i] {
+					discardAttempt(tasks[i], taskAttempt{index: i, result: result})
+				}
+			}
+			return nil, &taskError{index: attempt.index, err: attempt.err}
+		}
+
+		results[attempt.index] = attempt.result
+		finished[attempt.index] = true
+		nFinished++
+		for _, attemptCancel := range attemptCancels[attempt.index] {
+			attemptCancel()
+		}
+
+		if !speculated && len(queue) == 0 && nFinished < len(tasks) && float64(nFinished) >= sched.speculation.Threshold*float64(len(tasks)) {
+			speculated = true
+			logrus.Debugf("Speculatively duplicating %d straggling %s tasks...", len(tasks)-nFinished, phase)
+			for i := range tasks {
+				if !finished[i] {
+					queue = append(queue, i)
+				}
+			}
+		}
+		launchQueued()
+	}
+
+	if sched.counters != nil {
+		sched.counters[phase+".queueMillis"] += queueDelay.Milliseconds()
+	}
+	return results, nil
+}
+
+func isQueued(queue []int, index int) bool {
+	for _, i := range queue {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+func discardAttempts(tasks []task, attemptCh <-chan taskAttempt, n int) {
+	for i := 0; i < n; i++ {
+		attempt := <-attemptCh
+		discardAttempt(tasks[attempt.index], attempt)
+	}
+}
+
+func discardAttempt(t task, attempt taskAttempt) {
+	if attempt.err != nil || t.discard == nil {
+		return
+	}
+	t.discard(context.Background(), attempt.result)
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// constantTask returns a task whose attempts succeed with `result`.
+func constantTask(result interface{}) task {
+	return task{run: func(ctx context.Context) (interface{}, error) {
+		return result, nil
+	}}
+}
+
+// stragglerTask returns a task whose first attempt blocks until it is
+// cancelled, or fails after a while, and whose later attempts succeed with
+// `result`. Once the first attempt is cancelled, `cancelled` is closed.
+func stragglerTask(result interface{}, cancelled chan<- struct{}) task {
+	var attempts int32
+	return task{run: func(ctx context.Context) (interface{}, error) {
+		if atomic.AddInt32(&attempts, 1) > 1 {
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			close(cancelled)
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("straggler was not duplicated")
+		}
+	}}
+}
+
+func TestRunTasksSpeculation(t *testing.T) {
+	cancelled := make(chan struct{})
+	tasks := []task{constantTask(0), constantTask(1), stragglerTask(2, cancelled), constantTask(3)}
+
+	results, err := runTasks(context.Background(), "test", tasks, schedule{speculation: &SpeculationPolicy{Threshold: 0.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{0, 1, 2, 3}; !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("the losing attempt was not cancelled")
+	}
+}
+
+func TestRunTasksSpeculationDiscardsLoser(t *testing.T) {
+	var attempts int32
+	winnerDone := make(chan struct{})
+	discarded := make(chan interface{}, 2)
+	tasks := []task{
+		constantTask("done"),
+		{
+			run: func(ctx context.Context) (interface{}, error) {
+				if atomic.AddInt32(&attempts, 1) > 1 {
+					defer close(winnerDone)
+					return "winner", nil
+				}
+				// Ignores cancellation and finishes after the duplicate.
+				<-winnerDone
+				return "loser", nil
+			},
+			discard: func(ctx context.Context, result interface{}) {
+				discarded <- result
+			},
+		},
+	}
+
+	results, err := runTasks(context.Background(), "test", tasks, schedule{speculation: &SpeculationPolicy{Threshold: 0.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"done", "winner"}; !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+	select {
+	case result := <-discarded:
+		if result != "loser" {
+			t.Errorf("discarded %v, want loser", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the result of the losing attempt was not discarded")
+	}
+}
+
+func TestRunTasksSpeculationFailedAttempt(t *testing.T) {
+	var attempts int32
+	duplicated := make(chan struct{})
+	tasks := []task{
+		constantTask(0),
+		{run: func(ctx context.Context) (interface{}, error) {
+			if atomic.AddInt32(&attempts, 1) > 1 {
+				close(duplicated)
+				time.Sleep(10 * time.Millisecond)
+				return 1, nil
+			}
+			// Fails while the duplicate is running, which must not fail
+			// the task.
+			<-duplicated
+			return nil, errors.New("first attempt failed")
+		}},
+	}
+
+	results, err := runTasks(context.Background(), "test", tasks, schedule{speculation: &SpeculationPolicy{Threshold: 0.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{0, 1}; !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+}
+
+func TestRunTasksFailure(t *testing.T) {
+	failure := errors.New("failed")
+	discarded := make(chan interface{}, 1)
+	tasks := []task{
+		{
+			run: func(ctx context.Context) (interface{}, error) {
+				return 0, nil
+			},
+			discard: func(ctx context.Context, result interface{}) {
+				discarded <- result
+			},
+		},
+		{run: func(ctx context.Context) (interface{}, error) {
+			return nil, failure
+		}},
+		{run: func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+	}
+
+	for _, speculation := range []*SpeculationPolicy{nil, {Threshold: 0.1}} {
+		_, err := runTasks(context.Background(), "test", tasks, schedule{speculation: speculation})
+		var taskErr *taskError
+		if !errors.As(err, &taskErr) {
+			t.Fatalf("returned %v, want a *taskError", err)
+		}
+		if taskErr.index != 1 || taskErr.err != failure {
+			t.Errorf("task %d failed with %v, want task 1 with %v", taskErr.index, taskErr.err, failure)
+		}
+
+		// Task 0 finished either before or after task 1 failed; its result
+		// is discarded in both cases.
+		select {
+		case result := <-discarded:
+			if result != 0 {
+				t.Errorf("discarded %v, want 0", result)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("the result of the finished task was not discarded")
+		}
+	}
+}
+
+func TestRunTasksMaxConcurrency(t *testing.T) {
+	const nTasks, maxConcurrency = 20, 3
+	var running, maxRunning int32
+	tasks := make([]task, nTasks)
+	for i := range tasks {
+		i := i
+		tasks[i] = task{run: func(ctx context.Context) (interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return i, nil
+		}}
+	}
+
+	counters := make(Counters)
+	results, err := runTasks(context.Background(), "map", tasks, schedule{maxConcurrency: maxConcurrency, counters: counters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result != i {
+			t.Errorf("result %d = %v, want %d", i, result, i)
+		}
+	}
+	if maxRunning > maxConcurrency {
+		t.Errorf("%d tasks ran at a time, want at most %d", maxRunning, maxConcurrency)
+	}
+	if _, ok := counters[CounterMapQueueMillis]; !ok {
+		t.Errorf("%s was not counted", CounterMapQueueMillis)
+	}
+}
+
+func TestRunTasksQueueOrder(t *testing.T) {
+	const nTasks = 10
+	launched := make(chan int, nTasks)
+	tasks := make([]task, nTasks)
+	for i := range tasks {
+		i := i
+		tasks[i] = task{run: func(ctx context.Context) (interface{}, error) {
+			launched <- i
+			return i, nil
+		}}
+	}
+
+	if _, err := runTasks(context.Background(), "test", tasks, schedule{maxConcurrency: 1}); err != nil {
+		t.Fatal(err)
+	}
+	close(launched)
+	want := 0
+	for i := range launched {
+		if i != want {
+			t.Fatalf("task %d was launched when task %d was expected", i, want)
+		}
+		want++
+	}
+}
+
+func TestRunTasksSpeculationWaitsForQueue(t *testing.T) {
+	// The straggler holds one of the two slots, so the other tasks are
+	// queued for the remaining one, and the straggler is only duplicated
+	// once the last of them has been launched.
+	cancelled := make(chan struct{})
+	var ran int32
+	tasks := []task{stragglerTask(0, cancelled)}
+	for i := 1; i < 4; i++ {
+		i := i
+		tasks = append(tasks, task{run: func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&ran, 1)
+			return i, nil
+		}})
+	}
+
+	results, err := runTasks(context.Background(), "test", tasks, schedule{
+		speculation:    &SpeculationPolicy{Threshold: 0.25},
+		maxConcurrency: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{0, 1, 2, 3}; !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+	if ran != 3 {
+		t.Errorf("%d other tasks ran, want 3", ran)
+	}
+}
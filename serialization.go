@@ -21,31 +21,182 @@
 package mare
 
 import (
+	"bufio"
 	"bytes"
-	"fmt"
+	"io"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
+// PairReader reads pairs one at a time. Read returns io.EOF once all pairs
+// have been read.
+type PairReader interface {
+	Read() (Pair, error)
+}
+
+// PairWriter writes pairs one at a time. Flush must be called once all
+// pairs have been written.
+type PairWriter interface {
+	Write(pair Pair) error
+	Flush() error
+}
+
+// Pairs are marshalled as tab-separated values, one pair per line. Tabs,
+// newlines, carriage returns and backslashes in keys and values are escaped
+// as `\t`, `\n`, `\r` and `\\` respectively, so that any pair survives a
+// round trip.
+//
+// For compatibility with plain TSV inputs, unmarshalling is lenient by
+// default: a line without any tab is taken as a value with an empty key,
+// cells after the second are kept as part of the value, and backslashes that
+// do not start a valid escape sequence are kept verbatim. In strict mode,
+// the latter two are reported as errors instead.
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
 func MarshalPairs(pairs []Pair) string {
 	buffer := new(bytes.Buffer)
 	for _, pair := range pairs {
-		buffer.WriteString(fmt.Sprintf("%s\t%s\n", pair.Key, pair.Value))
+		buffer.WriteString(marshalPair(pair))
 	}
 	return buffer.String()
 }
 
+func marshalPair(pair Pair) string {
+	return tsvEscaper.Replace(pair.Key) + "\t" + tsvEscaper.Replace(pair.Value) + "\n"
+}
+
 func UnmarshalPairs(data string) (pairs []Pair) {
 	for _, line := range strings.Split(data, "\n") {
 		if line == "" {
 			continue
 		}
-		cells := strings.Split(line, "\t")
-		// if there are no "columns", assume empty key and take data as values
-		if len(cells) == 1 {
-			pairs = append(pairs, Pair{Key: "", Value: cells[0]})
-		} else {
-			pairs = append(pairs, Pair{Key: cells[0], Value: cells[1]})
+		pair, _ := unmarshalPair(line, false)
+		pairs = append(pairs, pair)
+	}
+	return
+}
+
+// UnmarshalPairsStrict is like UnmarshalPairs but fails on malformed lines.
+func UnmarshalPairsStrict(data string) (pairs []Pair, err error) {
+	for i, line := range strings.Split(data, "\n") {
+		if line == "" {
+			continue
+		}
+		pair, err := unmarshalPair(line, true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", i+1)
 		}
+		pairs = append(pairs, pair)
 	}
 	return
 }
+
+func unmarshalPair(line string, strict bool) (Pair, error) {
+	line = strings.TrimSuffix(line, "\r")
+	cells := strings.SplitN(line, "\t", 2)
+	// if there are no "columns", assume empty key and take data as values
+	if len(cells) == 1 {
+		value, err := unescapeTSV(cells[0], strict)
+		return Pair{Key: "", Value: value}, err
+	}
+	if strict && strings.Contains(cells[1], "\t") {
+		return Pair{}, errors.New("more than two cells")
+	}
+	key, err := unescapeTSV(cells[0], strict)
+	if err != nil {
+		return Pair{}, err
+	}
+	value, err := unescapeTSV(cells[1], strict)
+	return Pair{Key: key, Value: value}, err
+}
+
+func unescapeTSV(cell string, strict bool) (string, error) {
+	if !strings.Contains(cell, `\`) {
+		return cell, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(cell); i++ {
+		if cell[i] != '\\' {
+			b.WriteByte(cell[i])
+			continue
+		}
+		if i+1 < len(cell) {
+			switch cell[i+1] {
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			case 't':
+				b.WriteByte('\t')
+				i++
+				continue
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case 'r':
+				b.WriteByte('\r')
+				i++
+				continue
+			}
+		}
+		if strict {
+			return "", errors.Errorf("invalid escape sequence at offset %d", i)
+		}
+		b.WriteByte('\\')
+	}
+	return b.String(), nil
+}
+
+// TSVReader reads pairs in the format of UnmarshalPairs, or of
+// UnmarshalPairsStrict if Strict is set.
+type TSVReader struct {
+	Strict bool
+
+	r    *bufio.Reader
+	line int
+}
+
+func NewTSVReader(r io.Reader) *TSVReader {
+	return &TSVReader{r: bufio.NewReader(r)}
+}
+
+func (t *TSVReader) Read() (Pair, error) {
+	for {
+		line, err := t.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return Pair{}, err
+		}
+		t.line++
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			continue
+		}
+		pair, err := unmarshalPair(line, t.Strict)
+		if err != nil {
+			return Pair{}, errors.Wrapf(err, "line %d", t.line)
+		}
+		return pair, nil
+	}
+}
+
+// TSVWriter writes pairs in the format of MarshalPairs.
+type TSVWriter struct {
+	w *bufio.Writer
+}
+
+func NewTSVWriter(w io.Writer) *TSVWriter {
+	return &TSVWriter{w: bufio.NewWriter(w)}
+}
+
+func (t *TSVWriter) Write(pair Pair) error {
+	_, err := t.w.WriteString(marshalPair(pair))
+	return err
+}
+
+func (t *TSVWriter) Flush() error {
+	return t.w.Flush()
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTSVRoundTrip(t *testing.T) {
+	pairs := []Pair{
+		{Key: "plain", Value: "value"},
+		{Key: "", Value: "empty key"},
+		{Key: "empty value", Value: ""},
+		{Key: "", Value: ""},
+		{Key: "tab\tkey", Value: "tab\tvalue\t"},
+		{Key: "newline\nkey", Value: "multi\nline\nvalue\n"},
+		{Key: "cr\r", Value: "\r\n"},
+		{Key: `back\slash`, Value: `\t is not a tab, \\ is not an escape\`},
+		{Key: "unicode ключ", Value: "значение ✓"},
+	}
+
+	data := MarshalPairs(pairs)
+	if got, err := UnmarshalPairsStrict(data); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, pairs) {
+		t.Errorf("UnmarshalPairsStrict(MarshalPairs(pairs)) = %q, want %q", got, pairs)
+	}
+	if got := UnmarshalPairs(data); !reflect.DeepEqual(got, pairs) {
+		t.Errorf("UnmarshalPairs(MarshalPairs(pairs)) = %q, want %q", got, pairs)
+	}
+
+	var b strings.Builder
+	w := NewTSVWriter(&b)
+	for _, pair := range pairs {
+		if err := w.Write(pair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != data {
+		t.Errorf("TSVWriter wrote %q, want %q", b.String(), data)
+	}
+
+	r := NewTSVReader(strings.NewReader(data))
+	r.Strict = true
+	var got []Pair
+	for {
+		pair, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, pair)
+	}
+	if !reflect.DeepEqual(got, pairs) {
+		t.Errorf("TSVReader read %q, want %q", got, pairs)
+	}
+}
+
+func TestTSVLenientAndStrict(t *testing.T) {
+	tests := []struct {
+		line      string
+		lenient   Pair
+		strictErr bool
+	}{
+		{line: "key\tvalue", lenient: Pair{Key: "key", Value: "value"}},
+		{line: "key\tvalue\r", lenient: Pair{Key: "key", Value: "value"}},
+		{line: "no tab at all", lenient: Pair{Key: "", Value: "no tab at all"}},
+		{line: "key\tvalue\textra", lenient: Pair{Key: "key", Value: "value\textra"}, strictErr: true},
+		{line: `C:\path\tvalue`, lenient: Pair{Key: "", Value: "C:\\path\tvalue"}, strictErr: true},
+		{line: "key\\\tvalue", lenient: Pair{Key: `key\`, Value: "value"}, strictErr: true},
+		{line: `key\x` + "\tvalue", lenient: Pair{Key: `key\x`, Value: "value"}, strictErr: true},
+		{line: `\\` + "\t" + `\t`, lenient: Pair{Key: `\`, Value: "\t"}},
+	}
+	for _, test := range tests {
+		if got := UnmarshalPairs(test.line + "\n"); len(got) != 1 || got[0] != test.lenient {
+			t.Errorf("UnmarshalPairs(%q) = %q, want [%q]", test.line, got, test.lenient)
+		}
+
+		got, err := UnmarshalPairsStrict(test.line + "\n")
+		if test.strictErr {
+			if err == nil {
+				t.Errorf("UnmarshalPairsStrict(%q) = %q, want an error", test.line, got)
+			}
+		} else if err != nil {
+			t.Errorf("UnmarshalPairsStrict(%q) failed: %v", test.line, err)
+		} else if len(got) != 1 || got[0] != test.lenient {
+			t.Errorf("UnmarshalPairsStrict(%q) = %q, want [%q]", test.line, got, test.lenient)
+		}
+	}
+}
+
+func TestTSVStrictErrorNamesLine(t *testing.T) {
+	r := NewTSVReader(strings.NewReader("a\tb\n\nc\td\te\n"))
+	r.Strict = true
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.Read()
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("got error %v, want one naming line 3", err)
+	}
+}
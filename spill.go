@@ -0,0 +1,356 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Reducers whose inputs may not fit in memory can sort-merge them instead of
+// grouping them in a map; see WorkMemoryBudget. The pairs of every input are
+// buffered, and the buffer is sorted by key and spilled to a run file
+// whenever it outgrows its share of the budget. The runs are then k-way
+// merged, so that only the values of a single key, plus a small buffer per
+// run, are in memory at a time.
+//
+// Half of the budget is shared among the buffers of the inputs being read;
+// the other half holds the last runs of inputs, which are only spilled if
+// they do not fit.
+
+// mergeFanIn is the maximum number of runs merged at once.
+const mergeFanIn = 64
+
+// pairOverhead is the memory a pair takes besides its key and value.
+const pairOverhead = int64(unsafe.Sizeof(Pair{}))
+
+func pairMemory(pair Pair) int64 {
+	return int64(len(pair.Key)+len(pair.Value)) + pairOverhead
+}
+
+// sortedRun is a sequence of pairs sorted by key, either spilled to a file
+// or kept in memory.
+type sortedRun struct {
+	// input and seq rank the run among the others: the values of a key are
+	// merged in the order of their runs, which is that of the inputs.
+	input int
+	seq   int
+
+	path  string
+	pairs []Pair
+}
+
+// spiller sorts and spills the runs of the inputs of a ReduceBatch.
+type spiller struct {
+	dir          string
+	bufferBudget int64
+
+	mu             sync.Mutex
+	residentBudget int64
+	runs           []*sortedRun
+	nSpilled       int
+}
+
+// mergeInputs sort-merges the inputs of `request` through run files in a
+// temporary directory, which is removed once the returned groups are closed.
+func (m *mareServer) mergeInputs(ctx context.Context, request *ReduceBatchRequest) (keyGroups, error) {
+	dir, err := ioutil.TempDir(m.spillDir, "mare-spill-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a spill directory")
+	}
+
+	var keep func(key string) bool
+	if !request.AllKeys {
+		keys := make(map[string]bool, len(request.Keys))
+		for _, key := range request.Keys {
+			keys[key] = true
+		}
+		keep = func(key string) bool { return keys[key] }
+	}
+
+	concurrency := m.fetchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultFetchConcurrency
+	}
+	s := &spiller{
+		dir:            dir,
+		bufferBudget:   m.memoryBudget / 2 / int64(concurrency),
+		residentBudget: m.memoryBudget / 2,
+	}
+	nValues := 0
+	var nValuesMu sync.Mutex
+	err = m.forEachInput(ctx, request.Inputs, func(ctx context.Context, i int) error {
+		n, err := s.spillInput(ctx, request.Inputs[i], i, m.strictTSV, keep)
+		nValuesMu.Lock()
+		nValues += n
+		nValuesMu.Unlock()
+		return err
+	})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	logrus.Debugf("Reducer merging %d runs, %d of which spilled, with %d values...", len(s.runs), s.nSpilled, nValues)
+
+	s.sortRuns()
+	if err := s.reduceRuns(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	groups, err := newMergedGroups(s.runs, dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return groups, nil
+}
+
+// spillInput reads the pairs of `input`, the i-th one, whose keys are to be
+// kept (all of them if `keep` is nil) into runs. It returns the number of
+// pairs kept.
+func (s *spiller) spillInput(ctx context.Context, input *Resource, i int, strictTSV bool, keep func(key string) bool) (int, error) {
+	var buffer []Pair
+	var size int64
+	seq := 0
+	nPairs := 0
+	err := readPairs(ctx, input, strictTSV, func(pair Pair) error {
+		if keep != nil && !keep(pair.Key) {
+			return nil
+		}
+		buffer = append(buffer, pair)
+		size += pairMemory(pair)
+		nPairs++
+		if size < s.bufferBudget {
+			return nil
+		}
+		if err := s.addRun(&sortedRun{input: i, seq: seq, pairs: buffer}, false); err != nil {
+			return err
+		}
+		buffer, size = nil, 0
+		seq++
+		return nil
+	})
+	if err != nil {
+		return nPairs, err
+	}
+	if len(buffer) == 0 {
+		return nPairs, nil
+	}
+	s.mu.Lock()
+	resident := size <= s.residentBudget
+	if resident {
+		s.residentBudget -= size
+	}
+	s.mu.Unlock()
+	return nPairs, s.addRun(&sortedRun{input: i, seq: seq, pairs: buffer}, resident)
+}
+
+// addRun sorts `run`, and spills it unless it is to be kept `resident` in
+// memory.
+func (s *spiller) addRun(run *sortedRun, resident bool) error {
+	sort.SliceStable(run.pairs, func(a, b int) bool {
+		return run.pairs[a].Key < run.pairs[b].Key
+	})
+	if !resident {
+		if err := s.spill(run); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, run)
+	if !resident {
+		s.nSpilled++
+	}
+	return nil
+}
+
+// spill writes the pairs of `run` to a file and releases them.
+func (s *spiller) spill(run *sortedRun) error {
+	path, err := s.writeRun(&slicePairReader{pairs: run.pairs})
+	if err != nil {
+		return errors.Wrap(err, "failed to spill run")
+	}
+	run.path = path
+	run.pairs = nil
+	return nil
+}
+
+// writeRun writes all pairs of `r` to a new run file, and returns its path.
+func (s *spiller) writeRun(r PairReader) (string, error) {
+	f, err := ioutil.TempFile(s.dir, "run-*")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create a run file")
+	}
+	defer f.Close()
+
+	w := BinaryCodec{}.NewWriter(f)
+	for {
+		pair, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if err := w.Write(pair); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// sortRuns sorts the runs by their rank. Runs are added as their inputs are
+// read, concurrently.
+func (s *spiller) sortRuns() {
+	sort.Slice(s.runs, func(a, b int) bool {
+		if s.runs[a].input != s.runs[b].input {
+			return s.runs[a].input < s.runs[b].input
+		}
+		return s.runs[a].seq < s.runs[b].seq
+	})
+}
+
+// reduceRuns merges consecutive runs into new ones in passes until at most
+// mergeFanIn runs are left, so that no more than mergeFanIn run files are
+// ever open at a time. A merged run ranks as the first of the runs it is
+// merged from, so the order of values is kept.
+func (s *spiller) reduceRuns() error {
+	for pass := 1; len(s.runs) > mergeFanIn; pass++ {
+		logrus.Debugf("Reducer merging %d runs in pass %d...", len(s.runs), pass)
+		var merged []*sortedRun
+		for i := 0; i < len(s.runs); i += mergeFanIn {
+			group := s.runs[i:]
+			if len(group) > mergeFanIn {
+				group = group[:mergeFanIn]
+			}
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+			run, err := s.mergeRuns(group)
+			if err != nil {
+				return err
+			}
+			merged = append(merged, run)
+		}
+		s.runs = merged
+	}
+	return nil
+}
+
+// mergeRuns merges `runs` into a new run file, and removes their files.
+func (s *spiller) mergeRuns(runs []*sortedRun) (*sortedRun, error) {
+	merger, err := openRuns(runs)
+	if err != nil {
+		return nil, err
+	}
+	path, err := s.writeRun(merger)
+	merger.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to merge runs")
+	}
+	for _, run := range runs {
+		if run.path != "" {
+			_ = os.Remove(run.path)
+		}
+	}
+	return &sortedRun{input: runs[0].input, seq: runs[0].seq, path: path}, nil
+}
+
+// openRuns returns a merger of `runs`, which rank in their order.
+func openRuns(runs []*sortedRun) (*pairMerger, error) {
+	cursors := make([]*pairCursor, 0, len(runs))
+	for i, run := range runs {
+		c := &pairCursor{rank: i, reader: &slicePairReader{pairs: run.pairs}}
+		if run.path != "" {
+			f, err := os.Open(run.path)
+			if err != nil {
+				(&pairMerger{cursors: cursors}).Close()
+				return nil, errors.Wrap(err, "failed to open run")
+			}
+			c.closer = f
+			c.reader = BinaryCodec{}.NewReader(f)
+		}
+		cursors = append(cursors, c)
+	}
+	merger, err := newPairMerger(cursors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read runs")
+	}
+	return merger, nil
+}
+
+// mergedGroups are key groups k-way merged from sorted runs, in key order.
+type mergedGroups struct {
+	dir    string
+	merger *pairMerger
+}
+
+// newMergedGroups merges `runs`, which rank in their order.
+func newMergedGroups(runs []*sortedRun, dir string) (*mergedGroups, error) {
+	merger, err := openRuns(runs)
+	if err != nil {
+		return nil, err
+	}
+	return &mergedGroups{dir: dir, merger: merger}, nil
+}
+
+func (g *mergedGroups) Next() (string, []string, error) {
+	pair, err := g.merger.Read()
+	if err == io.EOF {
+		return "", nil, err
+	} else if err != nil {
+		return "", nil, errors.Wrap(err, "failed to read runs")
+	}
+	key, values := pair.Key, []string{pair.Value}
+	for {
+		next, ok := g.merger.Peek()
+		if !ok || next.Key != key {
+			return key, values, nil
+		}
+		if _, err := g.merger.Read(); err != nil {
+			return "", nil, errors.Wrap(err, "failed to read runs")
+		}
+		values = append(values, next.Value)
+	}
+}
+
+// Close removes the run files.
+func (g *mergedGroups) Close() error {
+	g.merger.Close()
+	return os.RemoveAll(g.dir)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type keyGroup struct {
+	key    string
+	values []string
+}
+
+func writeTestInputs(t *testing.T, nInputs, nPairs, nKeys int) []*Resource {
+	ctx := context.Background()
+	hint := &ResourceHint{Backend: ResourceBackend_FILE, Hint: t.TempDir()}
+	inputs := make([]*Resource, nInputs)
+	for i := range inputs {
+		w, err := createPairResource(ctx, hint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < nPairs; j++ {
+			key := fmt.Sprintf("key-%03d", (i*7+j*13)%nKeys)
+			if err := w.Write(Pair{Key: key, Value: fmt.Sprintf("%d-%d", i, j)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if inputs[i], err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return inputs
+}
+
+func collectGroups(t *testing.T, m *mareServer, request *ReduceBatchRequest) []keyGroup {
+	groups, err := m.groupInputs(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer groups.Close()
+
+	var result []keyGroup
+	for {
+		key, values, err := groups.Next()
+		if err == io.EOF {
+			return result
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, keyGroup{key, values})
+	}
+}
+
+// TestMergeInputsMatchesMemory checks that sort-merging reducer inputs
+// through spilled runs groups them exactly as grouping them in memory does,
+// including the order of values, whether a few or many runs are spilled.
+func TestMergeInputsMatchesMemory(t *testing.T) {
+	inputs := writeTestInputs(t, 5, 400, 50)
+	var someKeys []string
+	for i := 0; i < 50; i += 3 {
+		someKeys = append(someKeys, fmt.Sprintf("key-%03d", i))
+	}
+	sort.Strings(someKeys)
+
+	requests := map[string]*ReduceBatchRequest{
+		"all keys":  {Inputs: inputs, AllKeys: true},
+		"some keys": {Inputs: inputs, Keys: someKeys},
+	}
+	for name, request := range requests {
+		want := collectGroups(t, &mareServer{}, request)
+		if len(want) == 0 {
+			t.Fatalf("%s: no groups", name)
+		}
+		for _, budget := range []int64{1, 1 << 10, 1 << 14, 1 << 30} {
+			t.Run(fmt.Sprintf("%s/budget=%d", name, budget), func(t *testing.T) {
+				m := &mareServer{memoryBudget: budget, spillDir: t.TempDir()}
+				got := collectGroups(t, m, request)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %d groups, want %d; first got %v, first want %v", len(got), len(want), got[0], want[0])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Inputs are split into byte ranges, which do not necessarily fall on line
+// boundaries. A split is made of the lines that *start* within its range: the
+// reader of a split skips the partial line at its beginning, which belongs to
+// the previous split, and reads past its end to finish its last line.
+
+// splitSlop lets the last split of an input be up to 10% larger than the
+// target split size, rather than leaving a tiny split at the end.
+const splitSlop = 1.1
+
+// splitInputs splits the inputs larger than `splitSize` bytes into splits of
+// about `splitSize` bytes. Inputs that cannot be split are kept whole.
+func splitInputs(ctx context.Context, inputs []*Resource, splitSize int64) ([]*Resource, error) {
+	var splits []*Resource
+	for _, input := range inputs {
+		curSplits, err := splitInput(ctx, input, splitSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to split input `%s`", input.Locator)
+		}
+		splits = append(splits, curSplits...)
+	}
+	return splits, nil
+}
+
+func splitInput(ctx context.Context, input *Resource, splitSize int64) ([]*Resource, error) {
+	splittable, err := isSplittable(input)
+	if err != nil {
+		return nil, err
+	} else if !splittable {
+		return []*Resource{input}, nil
+	}
+
+	size, err := input.size(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if float64(size) <= splitSlop*float64(splitSize) {
+		return []*Resource{input}, nil
+	}
+
+	// Compressed inputs cannot be split, so check for the ones that do not
+	// have an extension, as late as possible.
+	if input.Compression == "" {
+		compressed, err := hasCompressionMagic(ctx, input)
+		if err != nil {
+			return nil, err
+		} else if compressed {
+			return []*Resource{input}, nil
+		}
+	}
+
+	var splits []*Resource
+	for offset := int64(0); offset < size; {
+		length := splitSize
+		if float64(size-offset) <= splitSlop*float64(splitSize) {
+			length = size - offset
+		}
+		splits = append(splits, &Resource{
+			Backend:     input.Backend,
+			Locator:     input.Locator,
+			Codec:       input.Codec,
+			Compression: input.Compression,
+			Offset:      offset,
+			Length:      length,
+		})
+		offset += length
+	}
+	return splits, nil
+}
+
+func isSplittable(input *Resource) (bool, error) {
+	if input.Length != 0 {
+		return false, nil
+	}
+	if input.Backend != ResourceBackend_FILE && input.Backend != ResourceBackend_S3 {
+		return false, nil
+	}
+	if compression, err := lookupCompression(input.Compression); err != nil {
+		return false, err
+	} else if compression != nil || compressionOfLocator(input.Locator) != nil {
+		return false, nil
+	}
+
+	codec, err := LookupCodec(input.Codec)
+	if err != nil {
+		return false, err
+	}
+	splittableCodec, ok := codec.(SplittableCodec)
+	return ok && splittableCodec.Splittable(), nil
+}
+
+func hasCompressionMagic(ctx context.Context, input *Resource) (bool, error) {
+	r, err := input.openAt(ctx, 0, maxMagicLength)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return compressionOfMagic(bufio.NewReader(r)) != nil, nil
+}
+
+// splitTailWindow is how far past its end a split is read at first, so as
+// to finish its last line. Longer lines are read in further, doubling,
+// windows.
+const splitTailWindow = 64 << 10
+
+// openSplit returns a reader of the lines of the split.
+func (x *Resource) openSplit(ctx context.Context) (io.ReadCloser, error) {
+	// Start a byte early, so as to tell whether the first line starts at
+	// offset or before it.
+	start := x.Offset
+	if start > 0 {
+		start--
+	}
+	r := &windowReader{
+		ctx:    ctx,
+		x:      x,
+		pos:    start,
+		limit:  x.Offset + x.Length + splitTailWindow,
+		window: 2 * splitTailWindow,
+	}
+	if err := r.open(start); err != nil {
+		return nil, err
+	}
+
+	s := &splitReader{
+		r:   bufio.NewReader(r),
+		c:   r,
+		pos: start,
+		end: x.Offset + x.Length,
+	}
+	if x.Offset > 0 {
+		skipped, err := s.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			r.Close()
+			return nil, errors.Wrap(err, "failed to find the first line of split")
+		}
+		s.pos += int64(len(skipped))
+	}
+	return s, nil
+}
+
+// windowReader reads the raw contents of a resource from `pos` on, in
+// windows that are opened only as they are needed, so that no more than
+// necessary is fetched past the end of a split.
+type windowReader struct {
+	ctx    context.Context
+	x      *Resource
+	r      io.ReadCloser
+	pos    int64
+	limit  int64
+	window int64
+	// skip is the number of bytes to skip at the beginning of the window.
+	skip int64
+}
+
+// open opens the window [from, limit).
+func (w *windowReader) open(from int64) error {
+	r, err := w.x.openAt(w.ctx, from, w.limit)
+	if err != nil {
+		return err
+	}
+	w.r = r
+	return nil
+}
+
+func (w *windowReader) Read(p []byte) (int, error) {
+	for {
+		n, err := w.r.Read(p)
+		if int64(n) <= w.skip {
+			w.skip -= int64(n)
+			n = 0
+		} else if w.skip > 0 {
+			n = copy(p, p[w.skip:n])
+			w.skip = 0
+		}
+		w.pos += int64(n)
+		if err != io.EOF || w.pos < w.limit {
+			if n == 0 && err == nil {
+				continue
+			}
+			return n, err
+		}
+
+		// The window is exhausted, but the resource may go on. Open the
+		// next one a byte early, so that it is never past the end of the
+		// resource.
+		w.r.Close()
+		w.limit = w.pos + w.window
+		w.window *= 2
+		w.skip = 1
+		if err := w.open(w.pos - 1); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (w *windowReader) Close() error {
+	return w.r.Close()
+}
+
+type splitReader struct {
+	r *bufio.Reader
+	c io.Closer
+	// pos is the offset, in the whole object, of the line after `line`.
+	pos  int64
+	end  int64
+	line []byte
+	err  error
+}
+
+func (s *splitReader) Read(p []byte) (int, error) {
+	for len(s.line) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.pos >= s.end {
+			return 0, io.EOF
+		}
+		s.line, s.err = s.r.ReadBytes('\n')
+		s.pos += int64(len(s.line))
+	}
+	n := copy(p, s.line)
+	s.line = s.line[n:]
+	return n, nil
+}
+
+func (s *splitReader) Close() error {
+	return s.c.Close()
+}
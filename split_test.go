@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readSplits returns the concatenation of the contents of `splits`.
+func readSplits(t *testing.T, splits []*Resource) string {
+	var b strings.Builder
+	for _, split := range splits {
+		r, err := split.Open(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(data)
+	}
+	return b.String()
+}
+
+func TestSplitsReassemble(t *testing.T) {
+	longLine := strings.Repeat("x", 3*splitTailWindow+17)
+	inputs := map[string]string{
+		"trailing newline":    "a\tb\ncc\tdd\neee\tfff\n",
+		"no trailing newline": "a\tb\ncc\tdd\neee\tfff",
+		"empty lines":         "\n\na\tb\n\n\ncc\tdd\n\n",
+		"crlf":                "a\tb\r\ncc\tdd\r\neee\tfff\r\n",
+		"single line":         "only\tline",
+		"long lines":          "a\tb\n" + longLine + "\nc\td\n" + longLine + longLine,
+	}
+	for name, data := range inputs {
+		path := filepath.Join(t.TempDir(), "input.tsv")
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		input := &Resource{Backend: ResourceBackend_FILE, Locator: path}
+		size := int64(len(data))
+
+		// Every split size small enough to matter, and a few larger ones.
+		var splitSizes []int64
+		for splitSize := int64(1); splitSize <= 24 && splitSize <= size; splitSize++ {
+			splitSizes = append(splitSizes, splitSize)
+		}
+		splitSizes = append(splitSizes, splitTailWindow-1, splitTailWindow+1, size-1, size, 2*size)
+
+		for _, splitSize := range splitSizes {
+			if splitSize < 1 || (splitSize < 1024 && size > 1<<16) {
+				continue
+			}
+			t.Run(fmt.Sprintf("%s/%d", name, splitSize), func(t *testing.T) {
+				splits, err := splitInputs(context.Background(), []*Resource{input}, splitSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := readSplits(t, splits); got != data {
+					t.Errorf("%d splits reassemble into %q, want %q", len(splits), abbreviate(got), abbreviate(data))
+				}
+			})
+		}
+	}
+}
+
+func TestSplitBoundaries(t *testing.T) {
+	data := "k1\tv1\nk2\tv2\nk3\tv3"
+	path := filepath.Join(t.TempDir(), "input.tsv")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 1, "k1\tv1\n"},
+		{0, 6, "k1\tv1\n"},
+		{0, 7, "k1\tv1\nk2\tv2\n"},
+		{5, 1, ""},
+		{6, 1, "k2\tv2\n"},
+		{7, 5, ""},
+		{7, 6, "k3\tv3"},
+		{12, 5, "k3\tv3"},
+		{13, 4, ""},
+	}
+	for _, test := range tests {
+		split := &Resource{Backend: ResourceBackend_FILE, Locator: path, Offset: test.offset, Length: test.length}
+		if got := readSplits(t, []*Resource{split}); got != test.want {
+			t.Errorf("split [%d, %d) = %q, want %q", test.offset, test.offset+test.length, got, test.want)
+		}
+	}
+}
+
+func abbreviate(s string) string {
+	if len(s) > 64 {
+		return fmt.Sprintf("%s...(%d bytes)", s[:64], len(s))
+	}
+	return s
+}
@@ -23,43 +23,76 @@ package mare
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"sort"
+	"sync"
 
-	tracing "github.com/ease-lab/vhive/utils/tracing/go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type mareServer struct {
 	UnimplementedMareServer
 
-	mapper  Mapper
-	reducer Reducer
+	mapper      Mapper
+	reducer     Reducer
+	partitioner Partitioner
+	combiner    Combiner
+	strictTSV   bool
+
+	mapParallelism    int
+	reduceParallelism int
+	fetchConcurrency  int
+	memoryBudget      int64
+	spillDir          string
 }
 
-func Work(mapper Mapper, reducer Reducer) error {
+// defaultFetchConcurrency is the number of inputs a reducer reads at a time
+// by default.
+const defaultFetchConcurrency = 4
+
+// Work serves MapBatch and ReduceBatch requests, as well as the resources
+// of the XDT backend. Either `mapper` or `reducer` may be nil for workers
+// that only map or only reduce, in which case the corresponding requests
+// fail with codes.Unimplemented; see also WorkMapOnly and WorkReduceOnly.
+func Work(mapper Mapper, reducer Reducer, opts ...WorkOption) error {
 	port := os.Getenv("PORT")
 	if port == "" {
 		logrus.Warn("PORT envvar is missing, defaulting to 80")
 		port = "80"
 	}
 
-	var grpcServer *grpc.Server
-	if tracing.IsTracingEnabled() {
-		grpcServer = tracing.GetGRPCServerWithUnaryInterceptor()
-	} else {
-		grpcServer = grpc.NewServer()
+	xdtAddress = os.Getenv("XDT_ADDRESS")
+	if xdtAddress == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "failed to get hostname")
+		}
+		xdtAddress = fmt.Sprintf("%s:%s", hostname, port)
 	}
 
+	grpcServer := grpc.NewServer(grpcServerOptions()...)
+
 	mareServer := mareServer{
-		mapper:  mapper,
-		reducer: reducer,
+		mapper:      mapper,
+		reducer:     reducer,
+		partitioner: HashPartitioner{},
+	}
+	for _, opt := range opts {
+		opt(&mareServer)
+	}
+	if mareServer.mapper == nil && mareServer.reducer == nil {
+		return errors.New("neither a mapper nor a reducer to serve")
 	}
 
 	RegisterMareServer(grpcServer, &mareServer)
+	RegisterXdtServer(grpcServer, &xdtServer{})
 	reflection.Register(grpcServer)
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
@@ -74,111 +107,469 @@ func Work(mapper Mapper, reducer Reducer) error {
 	return nil
 }
 
+func (m *mareServer) Capabilities(context.Context, *CapabilitiesRequest) (*CapabilitiesResponse, error) {
+	_, isDefault := m.partitioner.(HashPartitioner)
+	return &CapabilitiesResponse{
+		Map:               m.mapper != nil,
+		Reduce:            m.reducer != nil,
+		CustomPartitioner: !isDefault,
+	}, nil
+}
+
 func (m *mareServer) MapBatch(ctx context.Context, request *MapBatchRequest) (*MapBatchResponse, error) {
+	if m.mapper == nil {
+		return nil, status.Error(codes.Unimplemented, "worker does not map")
+	}
+	if request.SampleSize > 0 {
+		return m.sampleBatch(ctx, request)
+	}
+
 	spanGet := MakeSpan("worker: map.get")
-	spanUnmarshal := MakeSpan("worker: map.unmarshal")
 	spanMap := MakeSpan("worker: map.map")
 	spanPut := MakeSpan("worker: map.put")
 
 	ctx = StartSpan(spanGet, ctx)
-	inputData, err := request.Input.Get(ctx)
+	input, err := request.Input.Open(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get input")
 	}
+	defer input.Close()
 	EndSpan(spanGet)
 
-	ctx = StartSpan(spanUnmarshal, ctx)
-	inputPairs := UnmarshalPairs(inputData)
-	EndSpan(spanUnmarshal)
+	reader, err := newPairReader(request.Input, input, m.strictTSV)
+	if err != nil {
+		return nil, err
+	}
+	partitioner := m.partitioner
+	if len(request.SplitPoints) > 0 {
+		partitioner = RangePartitioner{SplitPoints: request.SplitPoints}
+	}
+	output := newMapOutput(ctx, request.OutputHint, partitioner, int(request.NPartitions))
+
+	// Without a combiner, output pairs are written as they are produced.
+	// With one, they have to be grouped by key first.
+	var uncombinedPairs []Pair
+	emit := output.Write
+	if m.combiner != nil {
+		emit = func(pair Pair) error {
+			uncombinedPairs = append(uncombinedPairs, pair)
+			return nil
+		}
+	}
 
-	logrus.Debugf("Mapper processing %d input pairs...", len(inputPairs))
+	logrus.Debug("Mapper processing input pairs...")
 
 	ctx = StartSpan(spanMap, ctx)
-	outputPairs := make([]Pair, 0)
-	keys := make(map[string]interface{})
-	for _, pair := range inputPairs {
-		curOutputPairs, err := m.mapper.Map(ctx, Pair{Key: pair.Key, Value: pair.Value})
+	nInputPairs, err := m.mapAll(ctx, reader, emit)
+	if err != nil {
+		output.Abort()
+		return nil, err
+	}
+	EndSpan(spanMap)
+
+	counters := make(Counters)
+	if m.combiner != nil {
+		spanCombine := MakeSpan("worker: map.combine")
+		ctx = StartSpan(spanCombine, ctx)
+		combinedPairs, err := m.combine(ctx, uncombinedPairs)
 		if err != nil {
-			return nil, errors.Wrap(err, "mapper error")
+			output.Abort()
+			return nil, errors.Wrap(err, "combiner error")
 		}
-		for _, pair := range curOutputPairs {
-			keys[pair.Key] = nil
-			outputPairs = append(outputPairs, pair)
+		for _, pair := range combinedPairs {
+			if err := output.Write(pair); err != nil {
+				output.Abort()
+				return nil, err
+			}
 		}
+		EndSpan(spanCombine)
+
+		counters[CounterCombineInputPairs] = int64(len(uncombinedPairs))
+		counters[CounterCombineOutputPairs] = int64(len(combinedPairs))
+		counters[CounterCombineInputBytes] = pairsSize(uncombinedPairs)
+		counters[CounterCombineOutputBytes] = pairsSize(combinedPairs)
+		logrus.Debugf("Combiner reduced %d pairs to %d...", len(uncombinedPairs), len(combinedPairs))
 	}
-	EndSpan(spanMap)
 
-	logrus.Debugf("Mapper uploading %d pairs with %d unique keys...", len(outputPairs), len(keys))
+	logrus.Debugf("Mapper uploading %d pairs from %d input pairs...", output.nPairs, nInputPairs)
 
 	ctx = StartSpan(spanPut, ctx)
-	output, err := request.OutputHint.Put(ctx, MarshalPairs(outputPairs))
+	response, err := output.Close()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to put output")
+		return nil, err
 	}
+	response.Counters = counters
 	EndSpan(spanPut)
 
+	if err := ctx.Err(); err != nil {
+		// The driver has abandoned this request (e.g. in favour of a
+		// speculative duplicate) so nobody will ever refer to the output.
+		if response.Output != nil {
+			discardOutput(context.Background(), response.Output)
+		}
+		discardPartitions(context.Background(), response.Partitions)
+		return nil, err
+	}
+
 	logrus.Debug("Mapper done.")
 
-	return &MapBatchResponse{
-		Output: output,
-		Keys:   MapKeys(keys),
-	}, nil
+	return response, nil
 }
 
-func (m *mareServer) ReduceBatch(ctx context.Context, request *ReduceBatchRequest) (*ReduceBatchResponse, error) {
-	spanGet := MakeSpan("worker: reduce.get")
-	spanUnmarshal := MakeSpan("worker: reduce.unmarshal-merge")
-	spanReduce := MakeSpan("worker: reduce.reduce")
-	spanPut := MakeSpan("worker: reduce.put")
+// mapAll runs the mapper over every pair read from `reader` and passes its
+// output pairs to `emit`, in the order of the input pairs, until the first
+// error. It returns the number of input pairs mapped.
+func (m *mareServer) mapAll(ctx context.Context, reader PairReader, emit func(pair Pair) error) (int, error) {
+	next := func() (orderedTask, error) {
+		pair, err := reader.Read()
+		if err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read input")
+		}
+		return func(ctx context.Context) ([]Pair, error) {
+			pairs, err := m.mapper.Map(ctx, pair)
+			return pairs, errors.Wrap(err, "mapper error")
+		}, nil
+	}
+	return runOrdered(ctx, m.mapParallelism, next, emit)
+}
 
-	logrus.Debugf("Reducer concatenating %d input partitions...", len(request.Inputs))
+// orderedTask computes the output pairs of a single input pair or key.
+type orderedTask func(ctx context.Context) ([]Pair, error)
+
+type orderedResult struct {
+	pairs []Pair
+	err   error
+}
 
+// runOrdered runs the tasks returned by `next`, until it returns io.EOF, and
+// passes their output pairs to `emit` in the order of the tasks, until the
+// first error. Up to `parallelism` tasks run at a time; `next` and `emit` are
+// only ever called by a single goroutine each. It returns the number of
+// tasks that succeeded.
+func runOrdered(ctx context.Context, parallelism int, next func() (orderedTask, error), emit func(pair Pair) error) (int, error) {
+	if parallelism <= 1 {
+		nTasks := 0
+		for {
+			if err := ctx.Err(); err != nil {
+				return nTasks, err
+			}
+			task, err := next()
+			if err == io.EOF {
+				return nTasks, nil
+			} else if err != nil {
+				return nTasks, err
+			}
+			pairs, err := task(ctx)
+			if err != nil {
+				return nTasks, err
+			}
+			nTasks++
+			for _, pair := range pairs {
+				if err := emit(pair); err != nil {
+					return nTasks, err
+				}
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The results of the tasks being run, in order. The one being waited
+	// for is not in the channel anymore, hence the capacity.
+	results := make(chan chan orderedResult, parallelism-1)
+	go func() {
+		defer close(results)
+		for {
+			task, err := next()
+			if err == io.EOF {
+				return
+			}
+
+			result := make(chan orderedResult, 1)
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				result <- orderedResult{err: err}
+				return
+			}
+			go func() {
+				pairs, err := task(ctx)
+				result <- orderedResult{pairs, err}
+			}()
+		}
+	}()
+	// Do not return before `next` is done being called.
+	defer func() {
+		cancel()
+		for range results {
+		}
+	}()
+
+	nTasks := 0
+	for result := range results {
+		if err := ctx.Err(); err != nil {
+			return nTasks, err
+		}
+		next := <-result
+		if next.err != nil {
+			return nTasks, next.err
+		}
+		nTasks++
+		for _, pair := range next.pairs {
+			if err := emit(pair); err != nil {
+				return nTasks, err
+			}
+		}
+	}
+	// Tasks stop being produced early if the context is cancelled.
+	return nTasks, ctx.Err()
+}
+
+// combine groups `pairs` by key and runs the combiner over each group. Groups
+// are combined in the order their keys first appear in `pairs`.
+func (m *mareServer) combine(ctx context.Context, pairs []Pair) ([]Pair, error) {
+	var keys []string
 	values := make(map[string][]string)
-	nValues := 0
+	for _, pair := range pairs {
+		if _, ok := values[pair.Key]; !ok {
+			keys = append(keys, pair.Key)
+		}
+		values[pair.Key] = append(values[pair.Key], pair.Value)
+	}
 
-	ctx = StartSpan(spanGet, ctx)
-	inputDatas := make([]string, 0)
-	for _, resource := range request.Inputs {
-		inputData, err := resource.Get(ctx)
+	combinedPairs := make([]Pair, 0, len(keys))
+	for _, key := range keys {
+		curCombinedPairs, err := m.combiner.Combine(ctx, key, values[key])
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get input")
+			return nil, err
 		}
-		inputDatas = append(inputDatas, inputData)
+		combinedPairs = append(combinedPairs, curCombinedPairs...)
 	}
-	EndSpan(spanGet)
+	return combinedPairs, nil
+}
+
+// keyGroups iterates over the values to reduce, grouped by key.
+type keyGroups interface {
+	// Next returns io.EOF once all keys have been returned.
+	Next() (key string, values []string, err error)
+	Close() error
+}
+
+// memoryGroups are key groups held in memory.
+type memoryGroups struct {
+	keys   []string
+	values map[string][]string
+}
 
-	ctx = StartSpan(spanUnmarshal, ctx)
-	for _, inputData := range inputDatas {
-		for _, pair := range UnmarshalPairs(inputData) {
-			values[pair.Key] = append(values[pair.Key], pair.Value)
-			nValues++
+func (g *memoryGroups) Next() (string, []string, error) {
+	if len(g.keys) == 0 {
+		return "", nil, io.EOF
+	}
+	key := g.keys[0]
+	g.keys = g.keys[1:]
+	return key, g.values[key], nil
+}
+
+func (g *memoryGroups) Close() error {
+	return nil
+}
+
+// groupInputs groups the values of the inputs of `request` by key, in
+// memory, or by sort-merging them if a memory budget is set. Keys are
+// returned in the order of request.Keys, or sorted if request.AllKeys is set
+// or the inputs are sort-merged.
+func (m *mareServer) groupInputs(ctx context.Context, request *ReduceBatchRequest) (keyGroups, error) {
+	if m.memoryBudget > 0 {
+		return m.mergeInputs(ctx, request)
+	}
+
+	values, nValues, err := m.fetchAll(ctx, request.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := request.Keys
+	if request.AllKeys {
+		keys = make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
 		}
+		sort.Strings(keys)
+	}
+
+	logrus.Debugf("Reducer processing %d keys with %d values...", len(keys), nValues)
+
+	return &memoryGroups{keys: keys, values: values}, nil
+}
+
+// fetchAll reads the pairs of `inputs` and groups their values by key. The
+// values of every key are in the order of the inputs, regardless of the
+// order the inputs are read in. It returns the number of values read.
+func (m *mareServer) fetchAll(ctx context.Context, inputs []*Resource) (map[string][]string, int, error) {
+	values := make(map[string][]string)
+	nValues := 0
+	group := func(pair Pair) error {
+		values[pair.Key] = append(values[pair.Key], pair.Value)
+		nValues++
+		return nil
+	}
+
+	if m.fetchConcurrency == 1 || len(inputs) <= 1 {
+		for _, input := range inputs {
+			if err := readPairs(ctx, input, m.strictTSV, group); err != nil {
+				return nil, 0, err
+			}
+		}
+		return values, nValues, nil
+	}
+
+	// Inputs are grouped in order, as soon as all earlier inputs are: the
+	// pairs of the input being grouped are grouped as they are read, and
+	// only those of inputs after it are buffered until its turn comes.
+	var mu sync.Mutex
+	next := 0
+	pending := make([][]Pair, len(inputs))
+	finished := make([]bool, len(inputs))
+	err := m.forEachInput(ctx, inputs, func(ctx context.Context, i int) error {
+		err := readPairs(ctx, inputs[i], m.strictTSV, func(pair Pair) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if i == next {
+				return group(pair)
+			}
+			pending[i] = append(pending[i], pair)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		finished[i] = true
+		for next < len(inputs) && finished[next] {
+			next++
+			if next < len(inputs) {
+				for _, pair := range pending[next] {
+					_ = group(pair)
+				}
+				pending[next] = nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return values, nValues, nil
+}
+
+// forEachInput calls `f` with the index of every input, for up to
+// fetchConcurrency inputs at a time, and returns the first error.
+func (m *mareServer) forEachInput(ctx context.Context, inputs []*Resource, f func(ctx context.Context, i int) error) error {
+	concurrency := m.fetchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultFetchConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var fetchErr error
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < len(inputs) && ctx.Err() == nil; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := f(ctx, i); err != nil {
+				errOnce.Do(func() {
+					fetchErr = err
+					cancel()
+				})
+			}
+		}(i)
 	}
-	EndSpan(spanUnmarshal)
+	wg.Wait()
 
-	logrus.Debugf("Reducer processing %d keys...", len(request.Keys))
+	if fetchErr == nil {
+		fetchErr = ctx.Err()
+	}
+	return fetchErr
+}
+
+func (m *mareServer) ReduceBatch(ctx context.Context, request *ReduceBatchRequest) (*ReduceBatchResponse, error) {
+	if m.reducer == nil {
+		return nil, status.Error(codes.Unimplemented, "worker does not reduce")
+	}
+
+	spanGet := MakeSpan("worker: reduce.get-merge")
+	spanReduce := MakeSpan("worker: reduce.reduce")
+	spanPut := MakeSpan("worker: reduce.put")
+
+	logrus.Debugf("Reducer concatenating %d input partitions...", len(request.Inputs))
+
+	ctx = StartSpan(spanGet, ctx)
+	groups, err := m.groupInputs(ctx, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get input")
+	}
+	defer groups.Close()
+	EndSpan(spanGet)
+
+	output, err := createPairResource(ctx, request.OutputHint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create output")
+	}
 
 	ctx = StartSpan(spanReduce, ctx)
-	var results []Pair
-	for _, key := range request.Keys {
-		curResults, err := m.reducer.Reduce(ctx, key, values[key])
+	next := func() (orderedTask, error) {
+		key, values, err := groups.Next()
 		if err != nil {
-			return nil, errors.Wrap(err, "reducer error")
+			return nil, err
 		}
-		results = append(results, curResults...)
+		return func(ctx context.Context) ([]Pair, error) {
+			results, err := m.reducer.Reduce(ctx, key, values)
+			return results, errors.Wrap(err, "reducer error")
+		}, nil
+	}
+	nResults := 0
+	_, err = runOrdered(ctx, m.reduceParallelism, next, func(result Pair) error {
+		nResults++
+		return errors.Wrap(output.Write(result), "failed to write output")
+	})
+	if err != nil {
+		output.Abort()
+		return nil, err
 	}
 	EndSpan(spanReduce)
 
-	logrus.Debugf("Reducer uploading %d pairs...", len(results))
+	logrus.Debugf("Reducer uploading %d pairs...", nResults)
 
 	ctx = StartSpan(spanPut, ctx)
-	output, err := request.OutputHint.Put(ctx, MarshalPairs(results))
+	outputResource, err := output.Close()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to put output")
 	}
-	EndSpan(spanReduce)
+	EndSpan(spanPut)
+
+	if err := ctx.Err(); err != nil {
+		// See MapBatch.
+		discardOutput(context.Background(), outputResource)
+		return nil, err
+	}
 
 	logrus.Debug("Reducer done.")
 
-	return &ReduceBatchResponse{Output: output}, nil
+	return &ReduceBatchResponse{Output: outputResource}, nil
 }
@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestFetchAllKeepsInputOrder checks that the values of every key are in
+// the order of the inputs, however many inputs are read at a time and in
+// whatever order they finish.
+func TestFetchAllKeepsInputOrder(t *testing.T) {
+	// The larger inputs first, so that later ones tend to finish earlier.
+	var inputs []*Resource
+	for _, nPairs := range []int{5000, 3000, 10, 2000, 1, 10, 500} {
+		inputs = append(inputs, writeTestInputs(t, 1, nPairs, 50)...)
+	}
+
+	want, wantValues, err := (&mareServer{fetchConcurrency: 1}).fetchAll(context.Background(), inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, concurrency := range []int{2, 3, 0, 16} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				got, nValues, err := (&mareServer{fetchConcurrency: concurrency}).fetchAll(context.Background(), inputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if nValues != wantValues {
+					t.Errorf("read %d values, want %d", nValues, wantValues)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatal("values differ from those read one input at a time")
+				}
+			}
+		})
+	}
+}
+
+func TestFetchAllFails(t *testing.T) {
+	inputs := writeTestInputs(t, 3, 100, 10)
+	inputs = append(inputs[:1], append([]*Resource{{Backend: ResourceBackend_FILE, Locator: "/nonexistent/input.tsv"}}, inputs[1:]...)...)
+	for _, concurrency := range []int{1, 4} {
+		if _, _, err := (&mareServer{fetchConcurrency: concurrency}).fetchAll(context.Background(), inputs); err == nil {
+			t.Errorf("concurrency=%d: fetching a missing input did not fail", concurrency)
+		}
+	}
+}
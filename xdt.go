@@ -0,0 +1,257 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The XDT backend transfers data directly between worker instances: a
+// resource is kept in the memory of the process that put it, and is served
+// to whoever gets it by the Xdt service of that process. Its locators are of
+// the form `xdt://<address>/<id>`, where <address> is the address of the
+// serving process, or `loopback` for resources that are only accessible from
+// within the same process (for testing on a single machine, or for the final
+// output of a driver embedded in a long-running service).
+//
+// Workers advertise the address in the XDT_ADDRESS envvar, defaulting to
+// their hostname and PORT. Note that the resources of a worker instance are
+// lost if the instance is scaled down before they are fetched.
+
+const (
+	xdtLoopback  = "loopback"
+	xdtChunkSize = 1 << 20
+)
+
+// xdtAddress is the address this process serves XDT resources on; set by
+// Work.
+var xdtAddress string
+
+type xdtStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+var localXDTStore = &xdtStore{objects: make(map[string][]byte)}
+
+func (s *xdtStore) put(data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := RandString(16)
+	s.objects[id] = data
+	return id
+}
+
+func (s *xdtStore) get(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[id]
+	return data, ok
+}
+
+func (s *xdtStore) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, id)
+}
+
+type xdtServer struct {
+	UnimplementedXdtServer
+}
+
+func (x *xdtServer) Fetch(request *XdtFetchRequest, stream Xdt_FetchServer) error {
+	data, ok := localXDTStore.get(request.Id)
+	if !ok {
+		return status.Errorf(codes.NotFound, "no XDT resource with id `%s`", request.Id)
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > xdtChunkSize {
+			n = xdtChunkSize
+		}
+		if err := stream.Send(&XdtChunk{Data: data[:n]}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (x *xdtServer) Release(_ context.Context, request *XdtReleaseRequest) (*XdtReleaseResponse, error) {
+	localXDTStore.release(request.Id)
+	return &XdtReleaseResponse{}, nil
+}
+
+func parseXDTLocator(locator string) (address string, id string, err error) {
+	parsed, err := url.Parse(locator)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to parse XDT locator")
+	}
+	if parsed.Scheme != "xdt" || parsed.Host == "" || len(parsed.Path) < 2 {
+		return "", "", fmt.Errorf("malformed XDT locator: %s", locator)
+	}
+	return parsed.Host, parsed.Path[1:], nil
+}
+
+// isLocalXDTAddress reports whether resources at `address` are in the
+// memory of this process.
+func isLocalXDTAddress(address string) bool {
+	return address == xdtLoopback || (xdtAddress != "" && address == xdtAddress)
+}
+
+func openXDTResource(ctx context.Context, locator string) (io.ReadCloser, error) {
+	address, id, err := parseXDTLocator(locator)
+	if err != nil {
+		return nil, err
+	}
+
+	if isLocalXDTAddress(address) {
+		data, ok := localXDTStore.get(id)
+		if !ok {
+			return nil, fmt.Errorf("no XDT resource `%s`", locator)
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	conn, err := getGrpcConn(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := NewXdtClient(conn).Fetch(ctx, &XdtFetchRequest{Id: id})
+	if err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "failed to fetch `%s`", locator)
+	}
+	return &xdtReader{cancel: cancel, stream: stream, locator: locator}, nil
+}
+
+// xdtReader reads a resource as it is streamed from a remote process.
+type xdtReader struct {
+	cancel  context.CancelFunc
+	stream  Xdt_FetchClient
+	locator string
+	chunk   []byte
+}
+
+func (r *xdtReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		chunk, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		} else if err != nil {
+			return 0, errors.Wrapf(err, "failed to fetch `%s`", r.locator)
+		}
+		r.chunk = chunk.Data
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *xdtReader) Close() error {
+	// Cancel the stream, which may not have been read to its end; the
+	// connection itself is pooled.
+	r.cancel()
+	return nil
+}
+
+// xdtWriter keeps the resource in the memory of this process. Workers serve
+// it on their address; other processes, such as the driver, only within the
+// process itself and only if the hint is `loopback`.
+type xdtWriter struct {
+	bytes.Buffer
+	address  string
+	codec    string
+	resource *Resource
+}
+
+func createXDTResource(hint string, codec string) (ResourceWriter, error) {
+	if err := checkXDTHint(hint, xdtAddress != ""); err != nil {
+		return nil, err
+	}
+	address := xdtAddress
+	if address == "" {
+		address = xdtLoopback
+	}
+	return &xdtWriter{address: address, codec: codec}, nil
+}
+
+// checkXDTHint checks whether XDT resources can be created with `hint` by a
+// process that is a worker, if `served` is set, or otherwise by one that is
+// not, such as the driver.
+func checkXDTHint(hint string, served bool) error {
+	if hint != "" && hint != xdtLoopback {
+		return fmt.Errorf("unknown XDT hint: %s", hint)
+	}
+	if !served && hint != xdtLoopback {
+		return errors.New("XDT backend is only served by workers; use the `loopback` hint otherwise")
+	}
+	return nil
+}
+
+func (w *xdtWriter) Close() error {
+	id := localXDTStore.put(w.Bytes())
+	w.resource = &Resource{Backend: ResourceBackend_XDT, Locator: fmt.Sprintf("xdt://%s/%s", w.address, id), Codec: w.codec}
+	return nil
+}
+
+func (w *xdtWriter) Abort() error {
+	w.Reset()
+	return nil
+}
+
+func (w *xdtWriter) Resource() *Resource {
+	return w.resource
+}
+
+func deleteXDTResource(ctx context.Context, locator string) error {
+	address, id, err := parseXDTLocator(locator)
+	if err != nil {
+		return err
+	}
+
+	if isLocalXDTAddress(address) {
+		localXDTStore.release(id)
+		return nil
+	}
+
+	conn, err := getGrpcConn(address)
+	if err != nil {
+		return err
+	}
+
+	if _, err := NewXdtClient(conn).Release(ctx, &XdtReleaseRequest{Id: id}); err != nil {
+		return errors.Wrapf(err, "failed to release `%s`", locator)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2021 Mert Bora Alper and EASE Lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mare
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestParseXDTLocator(t *testing.T) {
+	tests := []struct {
+		locator, address, id string
+		ok                   bool
+	}{
+		{"xdt://loopback/abc", "loopback", "abc", true},
+		{"xdt://10.0.0.1:8080/abc", "10.0.0.1:8080", "abc", true},
+		{"xdt://loopback/", "", "", false},
+		{"xdt://loopback", "", "", false},
+		{"xdt:///abc", "", "", false},
+		{"s3://bucket/abc", "", "", false},
+		{"/tmp/abc", "", "", false},
+		{"xdt://%zz/abc", "", "", false},
+	}
+	for _, test := range tests {
+		address, id, err := parseXDTLocator(test.locator)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseXDTLocator(%q) = %q, %q, want an error", test.locator, address, id)
+			}
+			continue
+		}
+		if err != nil || address != test.address || id != test.id {
+			t.Errorf("parseXDTLocator(%q) = %q, %q, %v, want %q, %q", test.locator, address, id, err, test.address, test.id)
+		}
+	}
+}
+
+func TestCheckXDTHint(t *testing.T) {
+	tests := []struct {
+		hint   string
+		served bool
+		ok     bool
+	}{
+		{"", true, true},
+		{xdtLoopback, true, true},
+		{xdtLoopback, false, true},
+		{"", false, false},
+		{"elsewhere", true, false},
+		{"elsewhere", false, false},
+	}
+	for _, test := range tests {
+		if err := checkXDTHint(test.hint, test.served); (err == nil) != test.ok {
+			t.Errorf("checkXDTHint(%q, %v) = %v, want ok = %v", test.hint, test.served, err, test.ok)
+		}
+	}
+}
+
+// testXDTRoundTrip puts `data` on XDT with `hint` and checks that it can be
+// read back, with `beforeOpen` called in between, and that it is gone once
+// deleted.
+func testXDTRoundTrip(t *testing.T, hint string, data string, beforeOpen func()) *Resource {
+	ctx := context.Background()
+	resource, err := (&ResourceHint{Backend: ResourceBackend_XDT, Hint: hint}).Put(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if beforeOpen != nil {
+		beforeOpen()
+	}
+
+	got, err := resource.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != data {
+		t.Errorf("%s reads %q, want %q", resource.Locator, abbreviate(got), abbreviate(data))
+	}
+
+	if err := resource.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resource.Get(ctx); err == nil {
+		t.Errorf("%s can still be read after it was deleted", resource.Locator)
+	}
+	return resource
+}
+
+func TestXDTLoopback(t *testing.T) {
+	if _, err := (&ResourceHint{Backend: ResourceBackend_XDT}).Create(context.Background()); err == nil {
+		t.Error("created an XDT resource without the loopback hint in an unserved process")
+	}
+
+	for _, data := range []string{"", "k\tv\n", strings.Repeat("x", 3*xdtChunkSize+1)} {
+		resource := testXDTRoundTrip(t, xdtLoopback, data, nil)
+		if !strings.HasPrefix(resource.Locator, "xdt://loopback/") {
+			t.Errorf("locator %s is not on loopback", resource.Locator)
+		}
+	}
+}
+
+func TestXDTServed(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	RegisterXdtServer(grpcServer, &xdtServer{})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	defer func(address string) {
+		xdtAddress = address
+	}(xdtAddress)
+
+	// Resources are put as by a worker serving them, and read and deleted
+	// as by another process, through the Xdt service.
+	for _, data := range []string{"", "k\tv\n", strings.Repeat("x", 3*xdtChunkSize+1)} {
+		xdtAddress = lis.Addr().String()
+		resource := testXDTRoundTrip(t, "", data, func() {
+			xdtAddress = ""
+		})
+		if want := "xdt://" + lis.Addr().String() + "/"; !strings.HasPrefix(resource.Locator, want) {
+			t.Errorf("locator %s does not start with %s", resource.Locator, want)
+		}
+	}
+}